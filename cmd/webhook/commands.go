@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"sigs.k8s.io/yaml"
+
+	"external-dns-openstack-webhook/internal/designate/provider"
+	"external-dns-openstack-webhook/internal/notify"
+)
+
+// output formats of the inspection subcommands
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+)
+
+// newCommandFlagSet creates the flag set of a subcommand including the shared options
+func newCommandFlagSet(name, usage string, opts *options) *pflag.FlagSet {
+	fs := pflag.NewFlagSet(name, pflag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s\n\nFlags:\n%s", os.Args[0], usage, fs.FlagUsages())
+	}
+	opts.addFlags(fs)
+	return fs
+}
+
+// runZones lists the zones matched by the domain filter
+func runZones(args []string) error {
+	var opts options
+	var format string
+	fs := newCommandFlagSet("zones", "zones [flags]", &opts)
+	fs.StringVarP(&format, "output", "o", formatTable, "Output format: table, json or yaml")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	defer opts.close()
+
+	dp, err := opts.newProvider(true)
+	if err != nil {
+		return err
+	}
+	managedZones, err := dp.(provider.ZoneLister).ManagedZones(context.Background())
+	if err != nil {
+		return err
+	}
+	return writeOutput(os.Stdout, format, managedZones, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ID\tNAME")
+		for _, z := range managedZones {
+			fmt.Fprintf(w, "%s\t%s\n", z.ID, z.Name)
+		}
+	})
+}
+
+// runRecords dumps the endpoints returned by Records
+func runRecords(args []string) error {
+	var opts options
+	var format string
+	fs := newCommandFlagSet("records", "records [flags]", &opts)
+	fs.StringVarP(&format, "output", "o", formatTable, "Output format: table, json or yaml")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	defer opts.close()
+
+	dp, err := opts.newProvider(true)
+	if err != nil {
+		return err
+	}
+	endpoints, err := dp.Records(context.Background())
+	if err != nil {
+		return err
+	}
+	sortEndpoints(endpoints)
+	return writeOutput(os.Stdout, format, endpoints, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "NAME\tTYPE\tTTL\tTARGETS\tZONE ID\tRECORDSET ID")
+		for _, ep := range endpoints {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", ep.DNSName, ep.RecordType, ep.RecordTTL,
+				strings.Join(ep.Targets, ","), ep.Labels[provider.ZoneIDLabel], ep.Labels[provider.RecordSetIDLabel])
+		}
+	})
+}
+
+// runApply runs a plan.Changes file through ApplyChanges
+func runApply(args []string) error {
+	var opts options
+	var file string
+	var dryRun bool
+	fs := newCommandFlagSet("apply", "apply -f changes.json [flags]", &opts)
+	fs.StringVarP(&file, "file", "f", "", "JSON or YAML file holding the changes to apply (\"-\" for stdin)")
+	fs.BoolVar(&dryRun, "dry-run", false, "Only log the changes that would be applied")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if file == "" {
+		return fmt.Errorf("--file is required")
+	}
+	defer opts.close()
+
+	var changes plan.Changes
+	if err := readFile(file, &changes); err != nil {
+		return err
+	}
+	for _, eps := range [][]*endpoint.Endpoint{changes.Create, changes.UpdateOld, changes.UpdateNew, changes.Delete} {
+		for _, ep := range eps {
+			if ep.Labels == nil {
+				ep.Labels = endpoint.Labels{}
+			}
+		}
+	}
+
+	dp, err := opts.newProvider(dryRun)
+	if err != nil {
+		return err
+	}
+	summary, err := dp.(provider.ChangeSummarizer).ApplyChangesWithSummary(context.Background(), &changes)
+	if err != nil {
+		return err
+	}
+	printApplySummary(os.Stdout, summary, dryRun)
+	return nil
+}
+
+// printApplySummary writes the number of recordsets created, updated and deleted by ApplyChanges
+func printApplySummary(w io.Writer, summary *notify.Summary, dryRun bool) {
+	verb := "Applied"
+	if dryRun {
+		verb = "Would apply"
+	}
+	fmt.Fprintf(w, "%s %d creates, %d updates and %d deletes\n", verb, len(summary.Created), len(summary.Updated), len(summary.Deleted))
+}
+
+// runDiff compares a file of desired endpoints against the records in Designate
+func runDiff(args []string) error {
+	var opts options
+	var file string
+	var exitCode bool
+	fs := newCommandFlagSet("diff", "diff -f endpoints.yaml [flags]", &opts)
+	fs.StringVarP(&file, "file", "f", "", "JSON or YAML file holding a list of desired endpoints (\"-\" for stdin)")
+	fs.BoolVar(&exitCode, "exit-code", false, "Exit with status 1 if there are differences")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if file == "" {
+		return fmt.Errorf("--file is required")
+	}
+	defer opts.close()
+
+	var desired []*endpoint.Endpoint
+	if err := readFile(file, &desired); err != nil {
+		return err
+	}
+
+	dp, err := opts.newProvider(true)
+	if err != nil {
+		return err
+	}
+	current, err := dp.Records(context.Background())
+	if err != nil {
+		return err
+	}
+
+	differences := diffEndpoints(os.Stdout, current, desired)
+	if differences > 0 && exitCode {
+		return exitCodeError(1)
+	}
+	return nil
+}
+
+// exitCodeError makes main exit with the given status after cleaning up, without logging an error
+type exitCodeError int
+
+func (e exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+// diffEndpoints writes the differences between the current and desired endpoints per name and type to w,
+// prefixed with "+" for missing, "-" for superfluous and "~" for differing records. Returns the number of differences.
+// The TTL is only compared if the desired endpoint configures one.
+func diffEndpoints(w io.Writer, current, desired []*endpoint.Endpoint) int {
+	key := func(ep *endpoint.Endpoint) string {
+		return strings.ToLower(strings.TrimSuffix(ep.DNSName, ".")) + " " + ep.RecordType
+	}
+	describe := func(ep *endpoint.Endpoint) string {
+		if ep.RecordTTL.IsConfigured() {
+			return fmt.Sprintf("ttl=%d %s", ep.RecordTTL, canonicalTargets(ep))
+		}
+		return canonicalTargets(ep)
+	}
+
+	currentByKey := map[string]*endpoint.Endpoint{}
+	for _, ep := range current {
+		currentByKey[key(ep)] = ep
+	}
+	desiredByKey := map[string]*endpoint.Endpoint{}
+	var keys []string
+	for _, ep := range desired {
+		desiredByKey[key(ep)] = ep
+		keys = append(keys, key(ep))
+	}
+	for k := range currentByKey {
+		if desiredByKey[k] == nil {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	keys = slices.Compact(keys)
+
+	differences := 0
+	for _, k := range keys {
+		c, d := currentByKey[k], desiredByKey[k]
+		switch {
+		case c == nil:
+			fmt.Fprintf(w, "+ %s %s\n", k, describe(d))
+		case d == nil:
+			fmt.Fprintf(w, "- %s %s\n", k, describe(c))
+		case canonicalTargets(c) != canonicalTargets(d) || d.RecordTTL.IsConfigured() && c.RecordTTL != d.RecordTTL:
+			fmt.Fprintf(w, "~ %s %s -> %s\n", k, describe(c), describe(d))
+		default:
+			continue
+		}
+		differences++
+	}
+	return differences
+}
+
+// canonicalTargets renders the targets of an endpoint ignoring their order and trailing dots
+func canonicalTargets(ep *endpoint.Endpoint) string {
+	targets := make([]string, len(ep.Targets))
+	for i, t := range ep.Targets {
+		targets[i] = strings.TrimSuffix(t, ".")
+	}
+	sort.Strings(targets)
+	return strings.Join(targets, ",")
+}
+
+// readFile decodes a JSON or YAML file, "-" reads from stdin
+func readFile(path string, v any) error {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeOutput writes v in the given format, using table to render the table format
+func writeOutput(w io.Writer, format string, v any, table func(w *tabwriter.Writer)) error {
+	switch format {
+	case formatTable:
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		table(tw)
+		return tw.Flush()
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case formatYAML:
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	default:
+		return fmt.Errorf("unknown output format %q, must be one of table, json or yaml", format)
+	}
+}
+
+// sortEndpoints orders endpoints by name and type
+func sortEndpoints(endpoints []*endpoint.Endpoint) {
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].DNSName != endpoints[j].DNSName {
+			return endpoints[i].DNSName < endpoints[j].DNSName
+		}
+		return endpoints[i].RecordType < endpoints[j].RecordType
+	})
+}
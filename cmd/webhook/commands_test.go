@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sigs.k8s.io/external-dns/endpoint"
+
+	"external-dns-openstack-webhook/internal/designate/fakeserver"
+	"external-dns-openstack-webhook/internal/notify"
+)
+
+func TestDiffEndpoints(t *testing.T) {
+	current := []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("same.example.com", endpoint.RecordTypeA, 300, "10.1.1.2", "10.1.1.1"),
+		endpoint.NewEndpointWithTTL("changed.example.com", endpoint.RecordTypeA, 300, "10.1.1.3"),
+		endpoint.NewEndpointWithTTL("ttl.example.com", endpoint.RecordTypeA, 300, "10.1.1.4"),
+		endpoint.NewEndpointWithTTL("removed.example.com", endpoint.RecordTypeTXT, 300, "text"),
+		endpoint.NewEndpointWithTTL("alias.example.com", endpoint.RecordTypeCNAME, 300, "www.example.com."),
+	}
+	desired := []*endpoint.Endpoint{
+		endpoint.NewEndpoint("same.example.com.", endpoint.RecordTypeA, "10.1.1.1", "10.1.1.2"),
+		endpoint.NewEndpoint("changed.example.com", endpoint.RecordTypeA, "10.1.1.9"),
+		endpoint.NewEndpointWithTTL("ttl.example.com", endpoint.RecordTypeA, 60, "10.1.1.4"),
+		endpoint.NewEndpoint("added.example.com", endpoint.RecordTypeA, "10.1.1.5"),
+		endpoint.NewEndpoint("alias.example.com", endpoint.RecordTypeCNAME, "www.example.com"),
+	}
+
+	var buf bytes.Buffer
+	if got := diffEndpoints(&buf, current, desired); got != 4 {
+		t.Errorf("got %d differences, want 4", got)
+	}
+	want := `+ added.example.com A 10.1.1.5
+~ changed.example.com A ttl=300 10.1.1.3 -> 10.1.1.9
+- removed.example.com TXT ttl=300 text
+~ ttl.example.com A ttl=300 10.1.1.4 -> ttl=60 10.1.1.4
+`
+	if buf.String() != want {
+		t.Errorf("got diff\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestPrintApplySummary(t *testing.T) {
+	summary := &notify.Summary{
+		Created: []notify.Change{{Name: "a.example.com.", Type: "A"}, {Name: "b.example.com.", Type: "A"}},
+		Deleted: []notify.Change{{Name: "c.example.com.", Type: "TXT"}},
+		Failed:  []notify.Change{{Name: "d.example.com.", Type: "A", Action: "update"}},
+	}
+	var buf bytes.Buffer
+	printApplySummary(&buf, summary, false)
+	printApplySummary(&buf, summary, true)
+	expected := "Applied 2 creates, 0 updates and 1 deletes\nWould apply 2 creates, 0 updates and 1 deletes\n"
+	if buf.String() != expected {
+		t.Errorf("got %q, expected %q", buf.String(), expected)
+	}
+}
+
+func TestRunDiffExitCode(t *testing.T) {
+	server := fakeserver.New()
+	defer server.Close()
+	zoneID := server.AddZone("example.com.")
+	server.AddRecordSet(zoneID, "www.example.com.", "A", 300, "10.1.1.1")
+	dir := t.TempDir()
+	cloudsYAML := filepath.Join(dir, "clouds.yaml")
+	if err := server.WriteCloudsYAML(cloudsYAML); err != nil {
+		t.Fatal(err)
+	}
+	desired := filepath.Join(dir, "desired.yaml")
+	if err := os.WriteFile(desired, []byte("- dnsName: www.example.com\n  recordType: A\n  targets: [10.1.1.2]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"--os-cloud", fakeserver.CloudName, "--clouds-yaml", cloudsYAML, "-f", desired}
+	if err := runDiff(args); err != nil {
+		t.Errorf("differences failed diff without --exit-code: %v", err)
+	}
+	var exitCode exitCodeError
+	if err := runDiff(append(args, "--exit-code")); !errors.As(err, &exitCode) || exitCode != 1 {
+		t.Errorf("got %v, expected exit code 1", err)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"external-dns-openstack-webhook/internal/designate/provider"
+)
+
+// runDriftDetection compares the recordsets in Designate with the ones written by the webhook every interval
+// until ctx is done
+func runDriftDetection(ctx context.Context, detector provider.DriftDetector, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		drifts, err := detector.DetectDrift(ctx)
+		if err != nil {
+			log.Errorf("Failed to detect drift: %v", err)
+			continue
+		}
+		log.Debugf("Drift detection found %d drifted recordsets", len(drifts))
+	}
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/pkg/apis/externaldns"
+	"sigs.k8s.io/external-dns/plan"
+	"sigs.k8s.io/external-dns/provider"
+	"sigs.k8s.io/external-dns/provider/webhook"
+	"sigs.k8s.io/external-dns/provider/webhook/api"
+	"sigs.k8s.io/external-dns/registry"
+	"sigs.k8s.io/external-dns/registry/txt"
+
+	"external-dns-openstack-webhook/internal/designate/client"
+	"external-dns-openstack-webhook/internal/designate/fakeserver"
+	designateprovider "external-dns-openstack-webhook/internal/designate/provider"
+)
+
+// e2eEnv serves the webhook API with the real provider, backed by a fake Designate
+type e2eEnv struct {
+	designate *fakeserver.Server
+	zoneID    string
+	webhook   *httptest.Server
+	// number of POST /records requests, i.e. ApplyChanges calls of external-dns
+	applies atomic.Int32
+}
+
+func newE2EEnv(t *testing.T) *e2eEnv {
+	t.Helper()
+	env := &e2eEnv{designate: fakeserver.New()}
+	t.Cleanup(env.designate.Close)
+	env.designate.PageSize = 3
+	env.zoneID = env.designate.AddZone("example.com.")
+	cloudsYAML := filepath.Join(t.TempDir(), "clouds.yaml")
+	if err := env.designate.WriteCloudsYAML(cloudsYAML); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := designateprovider.NewDesignateProvider(*endpoint.NewDomainFilter([]string{"example.com"}), false,
+		client.Config{Cloud: fakeserver.CloudName, CloudsYAML: cloudsYAML})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := webhookHandler(p)
+	env.webhook = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == api.UrlRecords {
+			env.applies.Add(1)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(env.webhook.Close)
+	return env
+}
+
+// do sends a request speaking the webhook protocol and decodes the response into result if not nil
+func (env *e2eEnv) do(t *testing.T, method, path string, body, result any) *http.Response {
+	t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, env.webhook.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", api.MediaTypeFormatAndVersion)
+	if body != nil {
+		req.Header.Set(api.ContentTypeHeader, api.MediaTypeFormatAndVersion)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			t.Fatalf("failed to decode response of %s %s: %v", method, path, err)
+		}
+	}
+	return resp
+}
+
+// controller connects a TXTRegistry through the webhook client of external-dns and returns a controller
+// reconciling the endpoints of src
+func (env *e2eEnv) controller(t *testing.T, ownerID string, src *staticSource) *e2eController {
+	t.Helper()
+	ctx := context.Background()
+	webhookProvider, err := webhook.New(ctx, &externaldns.Config{
+		WebhookProviderURL:          env.webhook.URL,
+		WebhookProviderReadTimeout:  5 * time.Second,
+		WebhookProviderWriteTimeout: 10 * time.Second,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	managedTypes := []string{endpoint.RecordTypeA, endpoint.RecordTypeCNAME, endpoint.RecordTypeTXT}
+	txtRegistry, err := txt.New(&externaldns.Config{TXTOwnerID: ownerID, ManagedDNSRecordTypes: managedTypes}, webhookProvider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &e2eController{
+		source:       src,
+		registry:     txtRegistry,
+		domainFilter: endpoint.NewDomainFilter([]string{"example.com"}),
+		managedTypes: managedTypes,
+	}
+}
+
+// runCycles runs n reconciliations and returns the number of ApplyChanges calls they made
+func (env *e2eEnv) runCycles(t *testing.T, c *e2eController, n int) int {
+	t.Helper()
+	before := env.applies.Load()
+	for i := range n {
+		if err := c.RunOnce(context.Background()); err != nil {
+			t.Fatalf("cycle %d failed: %v", i+1, err)
+		}
+	}
+	return int(env.applies.Load() - before)
+}
+
+// designateWrites counts the requests changing recordsets in Designate
+func (env *e2eEnv) designateWrites() int {
+	count := 0
+	for _, r := range env.designate.Requests() {
+		method, path, _ := strings.Cut(r, " ")
+		if method != http.MethodGet && strings.Contains(path, "/recordsets") {
+			count++
+		}
+	}
+	return count
+}
+
+// recordSets describes the recordsets of the zone besides SOA and NS, and returns their IDs by name and type
+func (env *e2eEnv) recordSets() ([]string, map[string]string) {
+	var described []string
+	ids := map[string]string{}
+	for _, rs := range env.designate.RecordSets(env.zoneID) {
+		if rs.Type == "SOA" || rs.Type == "NS" {
+			continue
+		}
+		records := slices.Clone(rs.Records)
+		sort.Strings(records)
+		described = append(described, fmt.Sprintf("%s %s %d %s", rs.Name, rs.Type, rs.TTL, strings.Join(records, ",")))
+		ids[rs.Name+" "+rs.Type] = rs.ID
+	}
+	return described, ids
+}
+
+// e2eController reconciles like Controller.RunOnce of external-dns, whose package pulls in all in-tree providers
+type e2eController struct {
+	source       *staticSource
+	registry     registry.Registry
+	domainFilter endpoint.DomainFilterInterface
+	managedTypes []string
+}
+
+func (c *e2eController) RunOnce(ctx context.Context) error {
+	current, err := c.registry.Records(ctx)
+	if err != nil {
+		return err
+	}
+	ctx = context.WithValue(ctx, provider.RecordsContextKey, current)
+	desired, err := c.source.Endpoints(ctx)
+	if err != nil {
+		return err
+	}
+	desired, err = c.registry.AdjustEndpoints(desired)
+	if err != nil {
+		return fmt.Errorf("adjusting endpoints: %w", err)
+	}
+	p := (&plan.Plan{
+		Policies:       []plan.Policy{&plan.SyncPolicy{}},
+		Current:        current,
+		Desired:        desired,
+		DomainFilter:   endpoint.MatchAllDomainFilters{c.domainFilter, c.registry.GetDomainFilter()},
+		ManagedRecords: c.managedTypes,
+		OwnerID:        c.registry.OwnerID(),
+	}).Calculate()
+	if !p.Changes.HasChanges() {
+		return nil
+	}
+	return c.registry.ApplyChanges(ctx, p.Changes)
+}
+
+// staticSource is a source of fixed endpoints
+type staticSource struct {
+	endpoints []*endpoint.Endpoint
+}
+
+func (s *staticSource) Endpoints(context.Context) ([]*endpoint.Endpoint, error) {
+	var endpoints []*endpoint.Endpoint
+	for _, ep := range s.endpoints {
+		endpoints = append(endpoints, ep.DeepCopy())
+	}
+	return endpoints, nil
+}
+
+func (s *staticSource) AddEventHandler(context.Context, func()) {}
+
+func sourceEndpoint(name, recordType string, ttl endpoint.TTL, resource string, targets ...string) *endpoint.Endpoint {
+	ep := endpoint.NewEndpointWithTTL(name, recordType, ttl, targets...)
+	ep.Labels[endpoint.ResourceLabelKey] = resource
+	return ep
+}
+
+func ownerTXT(ownerID, resource string) string {
+	return fmt.Sprintf(`"heritage=external-dns,external-dns/owner=%s,external-dns/resource=%s"`, ownerID, resource)
+}
+
+func TestE2ENegotiation(t *testing.T) {
+	env := newE2EEnv(t)
+
+	var filter endpoint.DomainFilter
+	resp := env.do(t, http.MethodGet, "/", nil, &filter)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get(api.ContentTypeHeader); ct != api.MediaTypeFormatAndVersion {
+		t.Errorf("got content type %q", ct)
+	}
+
+	if _, err := webhook.New(context.Background(), &externaldns.Config{
+		WebhookProviderURL:          env.webhook.URL,
+		WebhookProviderReadTimeout:  time.Second,
+		WebhookProviderWriteTimeout: time.Second,
+	}, nil); err != nil {
+		t.Errorf("webhook client of external-dns failed to negotiate: %v", err)
+	}
+}
+
+func TestE2ERecordsProtocol(t *testing.T) {
+	env := newE2EEnv(t)
+	env.designate.AddRecordSet(env.zoneID, "www.example.com.", endpoint.RecordTypeA, 300, "10.0.0.1", "10.0.0.2")
+	env.designate.AddRecordSet(env.zoneID, "old.example.com.", endpoint.RecordTypeCNAME, 0, "www.example.com.")
+
+	var records []*endpoint.Endpoint
+	resp := env.do(t, http.MethodGet, api.UrlRecords, nil, &records)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get(api.ContentTypeHeader) != api.MediaTypeFormatAndVersion {
+		t.Fatalf("got status %d and content type %q", resp.StatusCode, resp.Header.Get(api.ContentTypeHeader))
+	}
+	byName := map[string]*endpoint.Endpoint{}
+	for _, ep := range records {
+		byName[ep.DNSName] = ep
+	}
+	www, old := byName["www.example.com"], byName["old.example.com"]
+	if len(records) != 2 || www == nil || old == nil {
+		t.Fatalf("unexpected records %v", records)
+	}
+	if www.Labels[designateprovider.RecordSetIDLabel] == "" || www.Labels[designateprovider.ZoneIDLabel] != env.zoneID {
+		t.Errorf("Designate labels did not survive the JSON encoding: %v", www.Labels)
+	}
+
+	// external-dns sends back the current endpoints including their labels
+	updated := www.DeepCopy()
+	updated.Targets = endpoint.Targets{"10.0.0.2", "10.0.0.3"}
+	changes := &plan.Changes{
+		Create:    []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("new.example.com", endpoint.RecordTypeA, 60, "10.0.0.4")},
+		UpdateOld: []*endpoint.Endpoint{www},
+		UpdateNew: []*endpoint.Endpoint{updated},
+		Delete:    []*endpoint.Endpoint{old},
+	}
+	if resp := env.do(t, http.MethodPost, api.UrlRecords, changes, nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("applying changes responded with status %d", resp.StatusCode)
+	}
+	got, ids := env.recordSets()
+	want := []string{
+		"new.example.com. A 60 10.0.0.4",
+		"www.example.com. A 300 10.0.0.2,10.0.0.3",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got recordsets\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if ids["www.example.com. A"] != www.Labels[designateprovider.RecordSetIDLabel] {
+		t.Error("updated recordset was recreated instead of updated in place")
+	}
+
+	// a change Designate refuses is reported as server error
+	conflict := &plan.Changes{Create: []*endpoint.Endpoint{endpoint.NewEndpoint("www.example.com", endpoint.RecordTypeA, "10.0.0.9")}}
+	env.designate.Fail(http.MethodPut, "/recordsets/", http.StatusConflict, 1)
+	if resp := env.do(t, http.MethodPost, api.UrlRecords, conflict, nil); resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("failed change responded with status %d", resp.StatusCode)
+	}
+	if resp := env.do(t, http.MethodPost, api.UrlRecords, "not changes", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("malformed changes responded with status %d", resp.StatusCode)
+	}
+}
+
+func TestE2EAdjustEndpoints(t *testing.T) {
+	env := newE2EEnv(t)
+
+	desired := []*endpoint.Endpoint{
+		sourceEndpoint("www.example.com", endpoint.RecordTypeA, 300, "ingress/default/web", "10.0.0.1"),
+		sourceEndpoint("api.example.com", endpoint.RecordTypeCNAME, 0, "service/default/api", "www.example.com"),
+	}
+	var adjusted []*endpoint.Endpoint
+	resp := env.do(t, http.MethodPost, api.UrlAdjustEndpoints, desired, &adjusted)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get(api.ContentTypeHeader) != api.MediaTypeFormatAndVersion {
+		t.Fatalf("got status %d and content type %q", resp.StatusCode, resp.Header.Get(api.ContentTypeHeader))
+	}
+	if !reflect.DeepEqual(adjusted, desired) {
+		t.Errorf("got adjusted endpoints %v, want %v", adjusted, desired)
+	}
+	if resp := env.do(t, http.MethodGet, api.UrlAdjustEndpoints, nil, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("GET responded with status %d", resp.StatusCode)
+	}
+}
+
+func TestE2EControllerCycles(t *testing.T) {
+	env := newE2EEnv(t)
+	// records not managed by external-dns must survive all cycles
+	env.designate.AddRecordSet(env.zoneID, "legacy.example.com.", endpoint.RecordTypeA, 600, "10.9.9.9")
+
+	src := &staticSource{endpoints: []*endpoint.Endpoint{
+		sourceEndpoint("www.example.com", endpoint.RecordTypeA, 300, "ingress/default/web", "10.0.0.1", "10.0.0.2"),
+		sourceEndpoint("api.example.com", endpoint.RecordTypeCNAME, 0, "service/default/api", "www.example.com"),
+	}}
+	c := env.controller(t, "e2e", src)
+
+	if applies := env.runCycles(t, c, 5); applies != 1 {
+		t.Fatalf("got %d ApplyChanges in the initial cycles, expected 1", applies)
+	}
+	got, ids := env.recordSets()
+	want := []string{
+		"a-www.example.com. TXT 3600 " + ownerTXT("e2e", "ingress/default/web"),
+		"api.example.com. CNAME 3600 www.example.com.",
+		"cname-api.example.com. TXT 3600 " + ownerTXT("e2e", "service/default/api"),
+		"legacy.example.com. A 600 10.9.9.9",
+		"www.example.com. A 300 10.0.0.1,10.0.0.2",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got recordsets\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// converged: further cycles neither call ApplyChanges nor touch Designate
+	writes := env.designateWrites()
+	if applies := env.runCycles(t, c, 5); applies != 0 {
+		t.Errorf("got %d ApplyChanges after convergence, update loop", applies)
+	}
+	if w := env.designateWrites(); w != writes {
+		t.Errorf("got %d writes to Designate after convergence", w-writes)
+	}
+
+	// changing the source updates recordsets and their TXT records in place and deletes removed ones
+	src.endpoints = []*endpoint.Endpoint{
+		sourceEndpoint("www.example.com", endpoint.RecordTypeA, 60, "ingress/default/web", "10.0.0.2", "10.0.0.3"),
+	}
+	if applies := env.runCycles(t, c, 5); applies != 1 {
+		t.Fatalf("got %d ApplyChanges after the source changed, expected 1", applies)
+	}
+	got, newIDs := env.recordSets()
+	want = []string{
+		"a-www.example.com. TXT 3600 " + ownerTXT("e2e", "ingress/default/web"),
+		"legacy.example.com. A 600 10.9.9.9",
+		"www.example.com. A 60 10.0.0.2,10.0.0.3",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got recordsets\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	for _, key := range []string{"www.example.com. A", "a-www.example.com. TXT", "legacy.example.com. A"} {
+		if newIDs[key] != ids[key] {
+			t.Errorf("recordset %s was recreated instead of updated in place", key)
+		}
+	}
+
+	// a second instance with another owner must not take over the records
+	other := env.controller(t, "other", src)
+	writes = env.designateWrites()
+	if err := other.RunOnce(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if w := env.designateWrites(); w != writes {
+		t.Errorf("instance of another owner wrote %d times to Designate", w-writes)
+	}
+	if applies := env.runCycles(t, c, 3); applies != 0 {
+		t.Errorf("got %d ApplyChanges of the owner after another owner ran", applies)
+	}
+}
+
+func TestE2EControllerAdoptsExistingTXT(t *testing.T) {
+	env := newE2EEnv(t)
+	// state left by an earlier external-dns instance, with an outdated target and a TXT record of the old format
+	env.designate.AddRecordSet(env.zoneID, "www.example.com.", endpoint.RecordTypeA, 300, "10.0.0.1")
+	env.designate.AddRecordSet(env.zoneID, "www.example.com.", endpoint.RecordTypeTXT, 300, ownerTXT("e2e", "ingress/default/web"))
+
+	src := &staticSource{endpoints: []*endpoint.Endpoint{
+		sourceEndpoint("www.example.com", endpoint.RecordTypeA, 300, "ingress/default/web", "10.0.0.5"),
+	}}
+	c := env.controller(t, "e2e", src)
+	for i := range 5 {
+		if err := c.RunOnce(context.Background()); err != nil {
+			t.Fatalf("cycle %d failed: %v", i+1, err)
+		}
+	}
+	writes := env.designateWrites()
+	if applies := env.runCycles(t, c, 5); applies != 0 {
+		t.Errorf("got %d ApplyChanges after convergence, update loop", applies)
+	}
+	if w := env.designateWrites(); w != writes {
+		t.Errorf("got %d writes to Designate after convergence", w-writes)
+	}
+
+	got, _ := env.recordSets()
+	want := []string{
+		"a-www.example.com. TXT 3600 " + ownerTXT("e2e", "ingress/default/web"),
+		"www.example.com. A 300 10.0.0.5",
+		"www.example.com. TXT 300 " + ownerTXT("e2e", "ingress/default/web"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got recordsets\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
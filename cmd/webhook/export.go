@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"external-dns-openstack-webhook/internal/designate/provider"
+)
+
+// runExport writes the managed zones as RFC 1035 zone files to a directory or stdout
+func runExport(args []string) error {
+	var opts options
+	var dir string
+	fs := newCommandFlagSet("export", "export [-d directory] [flags]", &opts)
+	fs.StringVarP(&dir, "directory", "d", "", "Directory to write one <zone>.zone file per zone to (stdout if empty)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	defer opts.close()
+
+	dp, err := opts.newProvider(true)
+	if err != nil {
+		return err
+	}
+	exporter := dp.(provider.ZoneExporter)
+	ctx := context.Background()
+	if dir != "" {
+		return exportZones(ctx, exporter, dir)
+	}
+
+	managedZones, err := exporter.ManagedZones(ctx)
+	if err != nil {
+		return err
+	}
+	for _, zone := range managedZones {
+		if err := exporter.ExportZone(ctx, zone, os.Stdout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportZones writes every managed zone to <dir>/<zone>.zone, replacing the files atomically
+func exportZones(ctx context.Context, exporter provider.ZoneExporter, dir string) error {
+	return exportZonesAs(ctx, exporter, dir, zoneFileName)
+}
+
+// exportZonesAs writes every managed zone to the file in dir named by fileName
+func exportZonesAs(ctx context.Context, exporter provider.ZoneExporter, dir string, fileName func(zoneName string) string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	managedZones, err := exporter.ManagedZones(ctx)
+	if err != nil {
+		return err
+	}
+	for _, zone := range managedZones {
+		if err := exportZoneFile(ctx, exporter, zone, filepath.Join(dir, fileName(zone.Name))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportZoneFile writes a zone to a temporary file first, which is renamed to path on success
+func exportZoneFile(ctx context.Context, exporter provider.ZoneExporter, zone provider.Zone, path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := exporter.ExportZone(ctx, zone, f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("failed to write zone file %s: %w", path, err)
+	}
+	return nil
+}
+
+// zoneFileName returns the file name a zone is exported to
+func zoneFileName(zoneName string) string {
+	return strings.TrimSuffix(zoneName, ".") + ".zone"
+}
+
+// backupFileName returns the file name a zone is backed up to at the given time
+func backupFileName(zoneName string, timestamp time.Time) string {
+	return strings.TrimSuffix(zoneName, ".") + "-" + timestamp.UTC().Format(time.RFC3339) + ".zone"
+}
+
+// parseBackupFileName returns the zone and time of a backup file name, ok is false for other files
+func parseBackupFileName(name string) (zone string, timestamp time.Time, ok bool) {
+	const stampLength = len("2006-01-02T15:04:05Z")
+	base, found := strings.CutSuffix(name, ".zone")
+	if !found || len(base) < stampLength+2 || base[len(base)-stampLength-1] != '-' {
+		return "", time.Time{}, false
+	}
+	timestamp, err := time.Parse(time.RFC3339, base[len(base)-stampLength:])
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return base[:len(base)-stampLength-1], timestamp, true
+}
+
+// backupZones exports every managed zone to a new timestamped file in dir and deletes all but the newest retention
+// backups of every zone. All backups are kept if retention is 0.
+func backupZones(ctx context.Context, exporter provider.ZoneExporter, dir string, timestamp time.Time, retention int) error {
+	err := exportZonesAs(ctx, exporter, dir, func(zoneName string) string {
+		return backupFileName(zoneName, timestamp)
+	})
+	if err != nil || retention <= 0 {
+		return err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	backups := map[string][]string{}
+	for _, entry := range entries {
+		if zone, _, ok := parseBackupFileName(entry.Name()); ok && entry.Type().IsRegular() {
+			backups[zone] = append(backups[zone], entry.Name())
+		}
+	}
+	for _, names := range backups {
+		// the timestamps in UTC sort like the times they denote
+		sort.Sort(sort.Reverse(sort.StringSlice(names)))
+		for _, name := range names[min(retention, len(names)):] {
+			if err := os.Remove(filepath.Join(dir, name)); err != nil {
+				return err
+			}
+			log.Debugf("Deleted old zone backup %s", name)
+		}
+	}
+	return nil
+}
+
+// runBackups backs up all managed zones to dir every interval until ctx is done, keeping retention backups per zone
+func runBackups(ctx context.Context, exporter provider.ZoneExporter, dir string, interval time.Duration, retention int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		startTime := time.Now()
+		if err := backupZones(ctx, exporter, dir, startTime, retention); err != nil {
+			log.Errorf("Failed to back up zones to %s: %v", dir, err)
+		} else {
+			log.Infof("Backed up zones to %s in %s", dir, time.Since(startTime))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"external-dns-openstack-webhook/internal/designate/provider"
+	"external-dns-openstack-webhook/internal/zonefile"
+)
+
+type fakeZoneExporter struct {
+	zones []provider.Zone
+}
+
+func (e fakeZoneExporter) ManagedZones(ctx context.Context) ([]provider.Zone, error) {
+	return e.zones, nil
+}
+
+func (e fakeZoneExporter) ZoneRecordSets(ctx context.Context, zoneID string) ([]zonefile.RecordSet, error) {
+	return nil, nil
+}
+
+func (e fakeZoneExporter) ExportZone(ctx context.Context, zone provider.Zone, w io.Writer) error {
+	if zone.ID == "broken" {
+		return fmt.Errorf("export failed")
+	}
+	_, err := fmt.Fprintf(w, "$ORIGIN %s\n", zone.Name)
+	return err
+}
+
+func TestExportZones(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backup")
+	exporter := fakeZoneExporter{zones: []provider.Zone{{ID: "1", Name: "example.com."}, {ID: "2", Name: "example.org."}}}
+	if err := exportZones(context.TODO(), exporter, dir); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "example.org.zone"))
+	if err != nil || string(data) != "$ORIGIN example.org.\n" {
+		t.Errorf("unexpected zone file %q: %v", data, err)
+	}
+
+	exporter.zones = []provider.Zone{{ID: "broken", Name: "example.com."}}
+	if err := exportZones(context.TODO(), exporter, dir); err == nil {
+		t.Error("expected error for failed export")
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("expected failed export to leave no temporary files, got %v", entries)
+	}
+	data, _ = os.ReadFile(filepath.Join(dir, "example.com.zone"))
+	if string(data) != "$ORIGIN example.com.\n" {
+		t.Errorf("failed export replaced previous backup with %q", data)
+	}
+}
+
+func TestBackupZones(t *testing.T) {
+	dir := t.TempDir()
+	exporter := fakeZoneExporter{zones: []provider.Zone{{ID: "1", Name: "example.com."}, {ID: "2", Name: "my-example.org."}}}
+	if err := os.WriteFile(filepath.Join(dir, "example.com.zone"), []byte("manual export"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	for i := range 4 {
+		if err := backupZones(context.TODO(), exporter, dir, start.Add(time.Duration(i)*time.Hour), 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var names []string
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	expected := []string{
+		"example.com-2024-05-01T12:00:00Z.zone",
+		"example.com-2024-05-01T13:00:00Z.zone",
+		"example.com.zone",
+		"my-example.org-2024-05-01T12:00:00Z.zone",
+		"my-example.org-2024-05-01T13:00:00Z.zone",
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("got files %v, expected %v", names, expected)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "my-example.org-2024-05-01T13:00:00Z.zone"))
+	if err != nil || string(data) != "$ORIGIN my-example.org.\n" {
+		t.Errorf("unexpected zone file %q: %v", data, err)
+	}
+
+	// a failed backup keeps the previous ones
+	exporter.zones = []provider.Zone{{ID: "broken", Name: "example.com."}}
+	if err := backupZones(context.TODO(), exporter, dir, start.Add(5*time.Hour), 1); err == nil {
+		t.Error("expected error for failed export")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != len(expected) {
+		t.Errorf("failed backup changed the backups: %v", entries)
+	}
+}
+
+func TestParseBackupFileName(t *testing.T) {
+	zone, timestamp, ok := parseBackupFileName("my-example.org-2024-05-01T13:00:00Z.zone")
+	if !ok || zone != "my-example.org" || !timestamp.Equal(time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)) {
+		t.Errorf("got %q %v %v", zone, timestamp, ok)
+	}
+	for _, name := range []string{"example.com.zone", "example.com-latest.zone", "-2024-05-01T13:00:00Z.zone", "example.com-2024-05-01T13:00:00Z.zone.1.tmp"} {
+		if _, _, ok := parseBackupFileName(name); ok {
+			t.Errorf("%q parsed as backup", name)
+		}
+	}
+}
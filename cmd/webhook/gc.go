@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/external-dns/plan"
+
+	"external-dns-openstack-webhook/internal/registry"
+)
+
+// runGarbageCollectTXT deletes TXT registry ownership records whose owned record is gone
+func runGarbageCollectTXT(args []string) error {
+	var opts options
+	var txtOwnerID, txtPrefix, txtSuffix, txtWildcardReplacement string
+	var dryRun bool
+	var limit int
+	fs := newCommandFlagSet("gc-txt", "gc-txt --txt-owner-id id [flags]", &opts)
+	fs.StringVar(&txtOwnerID, "txt-owner-id", "", "Owner ID of the external-dns TXT registry whose orphaned records are deleted")
+	fs.StringVar(&txtPrefix, "txt-prefix", "", "Prefix of the TXT registry records as configured in external-dns")
+	fs.StringVar(&txtSuffix, "txt-suffix", "", "Suffix of the TXT registry records as configured in external-dns")
+	fs.StringVar(&txtWildcardReplacement, "txt-wildcard-replacement", "", "Replacement of wildcards in TXT registry record names as configured in external-dns")
+	fs.BoolVar(&dryRun, "dry-run", false, "Only print the orphaned records")
+	fs.IntVar(&limit, "limit", 0, "Maximum number of records deleted in one run (0 for no limit)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if txtOwnerID == "" {
+		return fmt.Errorf("--txt-owner-id is required")
+	}
+	if txtPrefix != "" && txtSuffix != "" {
+		return fmt.Errorf("--txt-prefix and --txt-suffix are mutually exclusive")
+	}
+	defer opts.close()
+
+	dp, err := opts.newProvider(dryRun)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	records, err := dp.Records(ctx)
+	if err != nil {
+		return err
+	}
+	orphans := registry.NewOrphanFinder(txtOwnerID, txtPrefix, txtSuffix, txtWildcardReplacement).FindOrphans(records)
+	if limit > 0 && len(orphans) > limit {
+		fmt.Fprintf(os.Stderr, "Found %d orphaned TXT records, only deleting the first %d\n", len(orphans), limit)
+		orphans = orphans[:limit]
+	}
+	for _, ep := range orphans {
+		fmt.Printf("- %s %s %s\n", ep.DNSName, ep.RecordType, canonicalTargets(ep))
+	}
+	if len(orphans) == 0 {
+		return nil
+	}
+	return dp.ApplyChanges(ctx, &plan.Changes{Delete: orphans})
+}
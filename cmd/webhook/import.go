@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"external-dns-openstack-webhook/internal/audit"
+	"external-dns-openstack-webhook/internal/designate/provider"
+	"external-dns-openstack-webhook/internal/zonefile"
+)
+
+// runImport restores the recordsets of a managed zone from an RFC 1035 zone file
+func runImport(args []string) error {
+	var opts options
+	var file, zoneName string
+	var dryRun, prune bool
+	fs := newCommandFlagSet("import", "import -f zone-file [--zone name] [flags]", &opts)
+	fs.StringVarP(&file, "file", "f", "", "Zone file to import (\"-\" for stdin)")
+	fs.StringVar(&zoneName, "zone", "", "Name of the zone to import into (defaults to the owner of the SOA record in the file)")
+	fs.BoolVar(&dryRun, "dry-run", false, "Only print the changes that would be applied")
+	fs.BoolVar(&prune, "prune", false, "Delete recordsets of the zone that are missing from the file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if file == "" {
+		return fmt.Errorf("--file is required")
+	}
+	defer opts.close()
+
+	recordSets, err := parseZoneFile(file, zoneName)
+	if err != nil {
+		return err
+	}
+	if zoneName == "" {
+		for _, rs := range recordSets {
+			if rs.Type == "SOA" {
+				zoneName = rs.Name
+			}
+		}
+		if zoneName == "" {
+			return fmt.Errorf("%s holds no SOA record, --zone is required", file)
+		}
+	}
+
+	dp, err := opts.newProvider(dryRun)
+	if err != nil {
+		return err
+	}
+	importer := dp.(provider.ZoneImporter)
+	ctx := context.Background()
+	zone, err := findManagedZone(ctx, importer, zoneName)
+	if err != nil {
+		return err
+	}
+	changes, err := importer.ImportZone(ctx, zone, recordSets, prune)
+	printImportChanges(os.Stdout, changes)
+	return err
+}
+
+// parseZoneFile reads a zone file, "-" reads from stdin
+func parseZoneFile(path, origin string) ([]zonefile.RecordSet, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	if origin == "" {
+		origin = "."
+	}
+	recordSets, err := zonefile.Parse(r, origin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return recordSets, nil
+}
+
+// findManagedZone returns the managed zone with the given name
+func findManagedZone(ctx context.Context, lister provider.ZoneLister, name string) (provider.Zone, error) {
+	managedZones, err := lister.ManagedZones(ctx)
+	if err != nil {
+		return provider.Zone{}, err
+	}
+	name = strings.ToLower(strings.TrimSuffix(name, ".")) + "."
+	for _, zone := range managedZones {
+		if zone.Name == name {
+			return zone, nil
+		}
+	}
+	return provider.Zone{}, fmt.Errorf("zone %s does not exist or is excluded by the domain filter", name)
+}
+
+// printImportChanges writes the changes in the format of the diff subcommand
+func printImportChanges(w io.Writer, changes []provider.ImportChange) {
+	for _, c := range changes {
+		prefix := map[string]string{audit.ActionCreate: "+", audit.ActionUpdate: "~", audit.ActionDelete: "-"}[c.Action]
+		var line string
+		switch c.Action {
+		case audit.ActionCreate:
+			line = fmt.Sprintf("%s %s ttl=%d %s", c.Name, c.Type, c.TTL, strings.Join(c.NewRecords, ","))
+		case audit.ActionDelete:
+			line = fmt.Sprintf("%s %s ttl=%d %s", c.Name, c.Type, c.OldTTL, strings.Join(c.OldRecords, ","))
+		default:
+			line = fmt.Sprintf("%s %s ttl=%d %s -> ttl=%d %s", c.Name, c.Type, c.OldTTL, strings.Join(c.OldRecords, ","),
+				c.TTL, strings.Join(c.NewRecords, ","))
+		}
+		if c.Skipped {
+			line += " (skipped)"
+		}
+		fmt.Fprintf(w, "%s %s\n", prefix, line)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"external-dns-openstack-webhook/internal/audit"
+	"external-dns-openstack-webhook/internal/designate/provider"
+)
+
+func TestFindManagedZone(t *testing.T) {
+	lister := fakeZoneExporter{zones: []provider.Zone{{ID: "1", Name: "example.com."}}}
+	if zone, err := findManagedZone(context.TODO(), lister, "Example.com"); err != nil || zone.ID != "1" {
+		t.Errorf("got zone %v: %v", zone, err)
+	}
+	if _, err := findManagedZone(context.TODO(), lister, "example.org."); err == nil {
+		t.Error("expected error for unmanaged zone")
+	}
+}
+
+func TestPrintImportChanges(t *testing.T) {
+	var buf bytes.Buffer
+	printImportChanges(&buf, []provider.ImportChange{
+		{Action: audit.ActionCreate, Name: "new.example.com.", Type: "A", TTL: 60, NewRecords: []string{"10.1.1.1"}},
+		{Action: audit.ActionUpdate, Name: "www.example.com.", Type: "A", OldTTL: 300, TTL: 300, OldRecords: []string{"10.1.1.2"}, NewRecords: []string{"10.1.1.3"}, Skipped: true},
+		{Action: audit.ActionDelete, Name: "old.example.com.", Type: "TXT", OldTTL: 300, OldRecords: []string{`"text"`}},
+	})
+	expected := `+ new.example.com. A ttl=60 10.1.1.1
+~ www.example.com. A ttl=300 10.1.1.2 -> ttl=300 10.1.1.3 (skipped)
+- old.example.com. TXT ttl=300 "text"
+`
+	if buf.String() != expected {
+		t.Errorf("got\n%s\nexpected\n%s", buf.String(), expected)
+	}
+}
@@ -1,18 +1,26 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 
+	"external-dns-openstack-webhook/internal/designate/client"
 	"external-dns-openstack-webhook/internal/designate/provider"
+	"external-dns-openstack-webhook/internal/events"
 	"external-dns-openstack-webhook/internal/metrics"
+	"external-dns-openstack-webhook/internal/notify"
+	"external-dns-openstack-webhook/internal/tracing"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"sigs.k8s.io/external-dns/endpoint"
-	"sigs.k8s.io/external-dns/provider/webhook/api"
 )
 
 const (
@@ -20,10 +28,115 @@ const (
 	statusServerAddr  = "0.0.0.0:8080"
 )
 
+// subcommands of the binary; the server is started if none is given
+var commands = map[string]func(args []string) error{
+	"serve":   runServer,
+	"zones":   runZones,
+	"records": runRecords,
+	"apply":   runApply,
+	"diff":    runDiff,
+	"export":  runExport,
+	"import":  runImport,
+	"gc-txt":  runGarbageCollectTXT,
+	"migrate": runMigrate,
+}
+
 func main() {
-	var domainFilters []string
-	pflag.StringArrayVar(&domainFilters, "domain-filter", []string{}, "List of domains to work on (can be specified multiple times)")
-	pflag.Parse()
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	command, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q, must be one of serve, zones, records, apply, diff, export, import, gc-txt or migrate\n", name)
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	shutdownTracing, err := tracing.Setup(ctx)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	err = command(args)
+	if err := shutdownTracing(ctx); err != nil {
+		log.Errorf("Failed to flush traces: %v", err)
+	}
+	var exitCode exitCodeError
+	if errors.As(err, &exitCode) {
+		os.Exit(int(exitCode))
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runServer starts the webhook and status servers
+func runServer(args []string) error {
+	var opts options
+	var backupDir string
+	var backupInterval time.Duration
+	var backupRetention int
+	var driftInterval time.Duration
+	var kubernetesEvents bool
+	var kubeconfig, eventsFallbackObject string
+	var notifyConfig notify.Config
+	var faultInjection string
+	fs := pflag.NewFlagSet("serve", pflag.ExitOnError)
+	opts.addFlags(fs)
+	fs.StringVar(&backupDir, "backup-dir", "", "Directory to periodically export all managed zones to as zone files (disabled if empty)")
+	fs.DurationVar(&backupInterval, "backup-interval", time.Hour, "Interval between two zone backups")
+	fs.IntVar(&backupRetention, "backup-retention", 48, "Number of backups kept per zone, older ones are deleted (0 keeps all)")
+	fs.DurationVar(&driftInterval, "drift-check-interval", 0, "Interval between two comparisons of the recordsets in Designate with the ones last written (disabled if 0)")
+	fs.BoolVar(&kubernetesEvents, "kubernetes-events", false, "Emit Kubernetes Events on the resources records originate from")
+	fs.StringVar(&kubeconfig, "kubeconfig", "", "Path to the kubeconfig file used for Kubernetes Events (in-cluster configuration if empty)")
+	fs.StringVar(&eventsFallbackObject, "events-fallback-object", "", "Object receiving events of records without known resource, as kind/namespace/name (defaults to pod/$POD_NAMESPACE/$POD_NAME)")
+	fs.StringVar(&notifyConfig.URL, "notify-url", "", "URL to post a summary of every batch of applied changes to (disabled if empty)")
+	fs.StringVar(&notifyConfig.Preset, "notify-preset", notify.PresetJSON, "Payload of the notifications: json, slack or teams")
+	fs.StringVar(&notifyConfig.TemplateFile, "notify-template", "", "Go template file rendering the notification payload, overriding --notify-preset")
+	fs.IntVar(&notifyConfig.Retries, "notify-retries", 3, "Number of retries of failed notifications")
+	fs.StringVar(&faultInjection, "fault-injection", "", "Faults to inject into the calls to Designate for testing, like error-rate=0.1,latency=200ms")
+	_ = fs.MarkHidden("fault-injection")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if faultInjection != "" {
+		faults, err := client.ParseFaultConfig(faultInjection)
+		if err != nil {
+			return fmt.Errorf("invalid fault injection: %w", err)
+		}
+		opts.clientConfig.Faults = &faults
+	}
+	if _, err := opts.providerOptions(); err != nil {
+		return err
+	}
+	defer opts.close()
+
+	var extraOptions []provider.Option
+	if kubernetesEvents {
+		recorder, err := newEventRecorder(kubeconfig, eventsFallbackObject)
+		if err != nil {
+			return err
+		}
+		defer recorder.Close()
+		extraOptions = append(extraOptions, provider.WithEvents(recorder))
+	}
+	if driftInterval > 0 {
+		extraOptions = append(extraOptions, provider.WithDriftDetection())
+	}
+	if notifyConfig.URL != "" {
+		notifier, err := notify.New(notifyConfig)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := notifier.Close(ctx); err != nil {
+				log.Errorf("Failed to deliver pending notifications: %v", err)
+			}
+		}()
+		extraOptions = append(extraOptions, provider.WithNotifier(notifier))
+	}
 
 	log.SetLevel(log.DebugLevel)
 
@@ -35,6 +148,10 @@ func main() {
 		httpApiStarted = true
 	}()
 
+	unmatchedRecords := provider.NewUnmatchedRecords()
+	debugInfo := provider.NewDebugInfo()
+	syncStatus := provider.NewSyncStatus()
+
 	m := http.NewServeMux()
 	m.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
 		if !httpApiStarted {
@@ -42,6 +159,9 @@ func main() {
 		}
 	})
 	m.HandleFunc("/metrics", promhttp.Handler().ServeHTTP)
+	m.Handle("/status", syncStatus)
+	m.Handle("/debug/unmatched", unmatchedRecords)
+	debugInfo.RegisterHandlers(m)
 
 	go func() {
 		log.Debugf("Starting status server on %s", statusServerAddr)
@@ -60,8 +180,8 @@ func main() {
 		}
 	}()
 
-	epf := endpoint.NewDomainFilter(domainFilters)
-	dp, err := provider.NewDesignateProvider(*epf, false)
+	extraOptions = append(extraOptions, provider.WithUnmatchedRecords(unmatchedRecords), provider.WithDebugInfo(debugInfo), provider.WithSyncStatus(syncStatus))
+	dp, err := opts.newProvider(false, extraOptions...)
 	if err != nil {
 		log.Fatalf("NewDesignateProvider: %v", err)
 		metrics.OpenstackConnectionMetric.Set(0)
@@ -69,6 +189,28 @@ func main() {
 	metrics.OpenstackConnectionMetric.Set(1)
 	log.Debugf("Connected to OpenStack API")
 
+	if backupDir != "" {
+		go runBackups(context.Background(), dp.(provider.ZoneExporter), backupDir, backupInterval, backupRetention)
+	}
+	if driftInterval > 0 {
+		go runDriftDetection(context.Background(), dp.(provider.DriftDetector), driftInterval)
+	}
+
 	log.Debugf("Starting webhook server on %s", webhookServerAddr)
-	api.StartHTTPApi(dp, startedChan, 0, 0, webhookServerAddr)
+	return startWebhookServer(dp, startedChan, webhookServerAddr)
+}
+
+// newEventRecorder connects to Kubernetes for emitting events, falling back to the object named by fallbackObject
+// or the pod named by the downward API environment variables
+func newEventRecorder(kubeconfig, fallbackObject string) (*events.Recorder, error) {
+	if fallbackObject == "" && os.Getenv("POD_NAMESPACE") != "" && os.Getenv("POD_NAME") != "" {
+		fallbackObject = "pod/" + os.Getenv("POD_NAMESPACE") + "/" + os.Getenv("POD_NAME")
+	}
+	if fallbackObject == "" {
+		return nil, fmt.Errorf("--events-fallback-object or the POD_NAMESPACE and POD_NAME environment variables are required for --kubernetes-events")
+	}
+	if _, err := events.ParseObjectReference(fallbackObject); err != nil {
+		return nil, fmt.Errorf("invalid events fallback object: %w", err)
+	}
+	return events.NewRecorder(kubeconfig, fallbackObject)
 }
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"external-dns-openstack-webhook/internal/designate/provider"
+	"external-dns-openstack-webhook/internal/registry"
+)
+
+// runMigrate rewrites the TXT ownership records of the in-tree designate provider into the current format
+// and stamps the owner ID into the recordsets they own
+func runMigrate(args []string) error {
+	var opts options
+	var oldTXTOwnerID, txtOwnerID, txtPrefix, txtSuffix, txtWildcardReplacement string
+	var keepOldFormat, dryRun bool
+	fs := newCommandFlagSet("migrate", "migrate --old-txt-owner-id id [flags]", &opts)
+	fs.StringVar(&oldTXTOwnerID, "old-txt-owner-id", "", "Owner ID found in the TXT registry records to migrate")
+	fs.StringVar(&txtOwnerID, "txt-owner-id", "", "Owner ID the TXT registry records are rewritten to (defaults to --old-txt-owner-id)")
+	fs.StringVar(&txtPrefix, "txt-prefix", "", "Prefix of the TXT registry records as configured in external-dns")
+	fs.StringVar(&txtSuffix, "txt-suffix", "", "Suffix of the TXT registry records as configured in external-dns")
+	fs.StringVar(&txtWildcardReplacement, "txt-wildcard-replacement", "", "Replacement of wildcards in TXT registry record names as configured in external-dns")
+	fs.BoolVar(&keepOldFormat, "keep-old-format", false, "Keep TXT registry records in the old format instead of deleting them once replaced")
+	fs.BoolVar(&dryRun, "dry-run", false, "Only print the migration report")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if oldTXTOwnerID == "" {
+		return fmt.Errorf("--old-txt-owner-id is required")
+	}
+	if txtPrefix != "" && txtSuffix != "" {
+		return fmt.Errorf("--txt-prefix and --txt-suffix are mutually exclusive")
+	}
+	defer opts.close()
+
+	// records of the old provider carry no owner ID, so they are only visible in guard mode
+	var extra []provider.Option
+	if opts.ownerID != "" {
+		extra = append(extra, provider.WithOwnership(opts.ownerID, provider.OwnershipGuard))
+	}
+	dp, err := opts.newProvider(dryRun, extra...)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	records, err := dp.Records(ctx)
+	if err != nil {
+		return err
+	}
+
+	migration := registry.NewMigration(oldTXTOwnerID, txtOwnerID, txtPrefix, txtSuffix, txtWildcardReplacement, keepOldFormat)
+	result := migration.Plan(records)
+	printMigrationReport(os.Stdout, result, opts.ownerID != "")
+	if dryRun {
+		return nil
+	}
+
+	if opts.ownerID != "" {
+		claimed, err := dp.(provider.OwnerClaimer).ClaimRecordSets(ctx, result.Owned)
+		if err != nil {
+			return fmt.Errorf("failed to claim recordsets: %w", err)
+		}
+		fmt.Printf("Claimed %d recordsets\n", claimed)
+	}
+	if !result.Changes.HasChanges() {
+		return nil
+	}
+	if err := dp.ApplyChanges(ctx, &result.Changes); err != nil {
+		return err
+	}
+	fmt.Printf("Created %d, updated %d and deleted %d TXT records\n", len(result.Changes.Create), len(result.Changes.UpdateNew), len(result.Changes.Delete))
+	return nil
+}
+
+// printMigrationReport writes the planned changes in the format of the diff subcommand, followed by the records to claim
+func printMigrationReport(w io.Writer, result registry.MigrationPlan, claim bool) {
+	for _, ep := range result.Changes.Create {
+		fmt.Fprintf(w, "+ %s %s %s\n", ep.DNSName, ep.RecordType, canonicalTargets(ep))
+	}
+	for i, ep := range result.Changes.UpdateNew {
+		fmt.Fprintf(w, "~ %s %s %s -> %s\n", ep.DNSName, ep.RecordType, canonicalTargets(result.Changes.UpdateOld[i]), canonicalTargets(ep))
+	}
+	for _, ep := range result.Changes.Delete {
+		fmt.Fprintf(w, "- %s %s %s\n", ep.DNSName, ep.RecordType, canonicalTargets(ep))
+	}
+	if !claim {
+		return
+	}
+	for _, ep := range result.Owned {
+		if ep.Labels[provider.OwnerIDLabel] == "" {
+			fmt.Fprintf(w, "claim %s %s\n", ep.DNSName, ep.RecordType)
+		}
+	}
+}
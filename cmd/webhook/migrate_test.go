@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+
+	"external-dns-openstack-webhook/internal/designate/provider"
+	"external-dns-openstack-webhook/internal/registry"
+)
+
+func TestPrintMigrationReport(t *testing.T) {
+	owned := endpoint.NewEndpoint("www.example.com", endpoint.RecordTypeA, "10.1.1.1")
+	claimed := endpoint.NewEndpoint("api.example.com", endpoint.RecordTypeA, "10.1.1.2")
+	claimed.Labels[provider.OwnerIDLabel] = "me"
+	result := registry.MigrationPlan{
+		Changes: plan.Changes{
+			Create:    []*endpoint.Endpoint{endpoint.NewEndpoint("a-www.example.com", endpoint.RecordTypeTXT, `"owner=new"`)},
+			UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpoint("a-api.example.com", endpoint.RecordTypeTXT, `"owner=old"`)},
+			UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpoint("a-api.example.com", endpoint.RecordTypeTXT, `"owner=new"`)},
+			Delete:    []*endpoint.Endpoint{endpoint.NewEndpoint("www.example.com", endpoint.RecordTypeTXT, `"owner=old"`)},
+		},
+		Owned: []*endpoint.Endpoint{claimed, owned},
+	}
+
+	var buf bytes.Buffer
+	printMigrationReport(&buf, result, true)
+	expected := `+ a-www.example.com TXT "owner=new"
+~ a-api.example.com TXT "owner=old" -> "owner=new"
+- www.example.com TXT "owner=old"
+claim www.example.com A
+`
+	if buf.String() != expected {
+		t.Errorf("got\n%s\nexpected\n%s", buf.String(), expected)
+	}
+}
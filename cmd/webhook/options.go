@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/external-dns/endpoint"
+	externaldnsprovider "sigs.k8s.io/external-dns/provider"
+
+	"external-dns-openstack-webhook/internal/audit"
+	"external-dns-openstack-webhook/internal/designate/client"
+	"external-dns-openstack-webhook/internal/designate/provider"
+)
+
+// options shared by the server and all subcommands
+type options struct {
+	domainFilters             []string
+	clientConfig              client.Config
+	ownerID                   string
+	ownershipMode             string
+	protectedNames            []string
+	protectedPatterns         []string
+	maxDeletions              int
+	maxDeletionPercent        float64
+	deletionThresholdOverride bool
+	auditLogPath              string
+	transactional             bool
+	zoneParents               []string
+	zoneEmail                 string
+	zoneDescription           string
+	zoneTTL                   int
+	delegation                bool
+	strictZoneMatching        bool
+
+	auditLogger *audit.Logger
+}
+
+// addFlags registers the command line flags for the options
+func (o *options) addFlags(fs *pflag.FlagSet) {
+	fs.StringArrayVar(&o.domainFilters, "domain-filter", []string{}, "List of domains to work on (can be specified multiple times)")
+	fs.StringVar(&o.clientConfig.Cloud, "os-cloud", "", "Name of the cloud in clouds.yaml to use (defaults to $OS_CLOUD)")
+	fs.StringVar(&o.clientConfig.CloudsYAML, "clouds-yaml", "", "Path to the clouds.yaml file (defaults to $OS_CLIENT_CONFIG_FILE or the standard locations)")
+	fs.StringVar(&o.clientConfig.SecureYAML, "secure-yaml", "", "Path to a secure.yaml file complementing clouds.yaml (defaults to secure.yaml next to clouds.yaml)")
+	fs.StringVar(&o.clientConfig.Region, "region", "", "OpenStack region to use (defaults to $OS_REGION_NAME or region_name from clouds.yaml)")
+	fs.StringVar(&o.clientConfig.Interface, "interface", "", "OpenStack endpoint interface to use: public, internal or admin (defaults to $OS_INTERFACE or interface from clouds.yaml)")
+	fs.StringVar(&o.ownerID, "owner-id", "", "Owner ID stamped into the description of created recordsets; enables ownership tracking if set")
+	fs.StringVar(&o.ownershipMode, "ownership-mode", string(provider.OwnershipFilter), "How recordsets of other owners are treated: filter (hide them) or guard (show but never change them)")
+	fs.StringArrayVar(&o.protectedNames, "protected-name", []string{}, "Name of a recordset that must never be changed (can be specified multiple times)")
+	fs.StringArrayVar(&o.protectedPatterns, "protected-regex", []string{}, "Regular expression matching FQDNs (with trailing dot) of recordsets that must never be changed (can be specified multiple times)")
+	fs.IntVar(&o.maxDeletions, "max-deletions", 0, "Maximum number of recordsets deleted in a single batch of changes (0 disables the check)")
+	fs.Float64Var(&o.maxDeletionPercent, "max-deletion-percent", 0, "Maximum percentage of the recordsets of a zone deleted in a single batch of changes (0 disables the check)")
+	fs.BoolVar(&o.deletionThresholdOverride, "deletion-threshold-override", false, "Apply deletions even if they exceed the deletion threshold, only reporting the violation")
+	fs.StringVar(&o.auditLogPath, "audit-log", "", "File to append a JSON line to for every change applied to Designate (\"-\" for stdout, disabled if empty)")
+	fs.BoolVar(&o.transactional, "transactional", false, "Roll back the already applied changes of a batch if one of them fails")
+	fs.StringArrayVar(&o.zoneParents, "zone-creation-parent", []string{}, "Parent domain below which missing zones are created for unmatched hostnames (can be specified multiple times)")
+	fs.StringVar(&o.zoneEmail, "zone-creation-email", "", "Contact email of automatically created zones")
+	fs.IntVar(&o.zoneTTL, "zone-creation-ttl", 0, "TTL of automatically created zones (Designate default if 0)")
+	fs.StringVar(&o.zoneDescription, "zone-creation-description", "Created by external-dns", "Description of automatically created zones")
+	fs.BoolVar(&o.delegation, "delegate-subzones", false, "Maintain NS recordsets in parent zones delegating to managed child zones")
+	fs.BoolVar(&o.strictZoneMatching, "strict-zone-matching", false, "Fail changes for records matching no managed zone instead of skipping them")
+}
+
+// providerOptions validates the options and converts them into provider options
+func (o *options) providerOptions() ([]provider.Option, error) {
+	if err := o.clientConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid OpenStack configuration: %w", err)
+	}
+
+	var providerOptions []provider.Option
+	if o.ownerID != "" {
+		mode, err := provider.ParseOwnershipMode(o.ownershipMode)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ownership configuration: %w", err)
+		}
+		providerOptions = append(providerOptions, provider.WithOwnership(o.ownerID, mode))
+	}
+	if len(o.protectedNames) > 0 || len(o.protectedPatterns) > 0 {
+		var patterns []*regexp.Regexp
+		for _, pattern := range o.protectedPatterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid protected record pattern %q: %w", pattern, err)
+			}
+			patterns = append(patterns, re)
+		}
+		providerOptions = append(providerOptions, provider.WithProtectedRecords(o.protectedNames, patterns))
+	}
+	if o.maxDeletions > 0 || o.maxDeletionPercent > 0 {
+		providerOptions = append(providerOptions, provider.WithDeletionThreshold(o.maxDeletions, o.maxDeletionPercent, o.deletionThresholdOverride))
+	}
+	if o.auditLogPath != "" && o.auditLogger == nil {
+		auditLogger, err := audit.NewLogger(o.auditLogPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open audit log: %w", err)
+		}
+		o.auditLogger = auditLogger
+	}
+	if o.auditLogger != nil {
+		providerOptions = append(providerOptions, provider.WithAuditLogger(o.auditLogger))
+	}
+	if o.transactional {
+		providerOptions = append(providerOptions, provider.WithTransactions())
+	}
+	if len(o.zoneParents) > 0 {
+		if o.zoneEmail == "" {
+			return nil, fmt.Errorf("--zone-creation-email is required when --zone-creation-parent is set")
+		}
+		providerOptions = append(providerOptions, provider.WithZoneCreation(o.zoneParents, o.zoneEmail, o.zoneTTL, o.zoneDescription))
+	}
+	if o.delegation {
+		providerOptions = append(providerOptions, provider.WithDelegation())
+	}
+	if o.strictZoneMatching {
+		providerOptions = append(providerOptions, provider.WithStrictZoneMatching())
+	}
+	return providerOptions, nil
+}
+
+// newProvider creates the designate provider from the options, adding the given extra provider options
+func (o *options) newProvider(dryRun bool, extra ...provider.Option) (externaldnsprovider.Provider, error) {
+	providerOptions, err := o.providerOptions()
+	if err != nil {
+		return nil, err
+	}
+	epf := endpoint.NewDomainFilter(o.domainFilters)
+	return provider.NewDesignateProvider(*epf, dryRun, o.clientConfig, append(providerOptions, extra...)...)
+}
+
+// close releases resources held by the options, i.e. the audit log
+func (o *options) close() {
+	if err := o.auditLogger.Close(); err != nil {
+		log.Errorf("Failed to close audit log: %v", err)
+	}
+}
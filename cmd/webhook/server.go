@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net"
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"sigs.k8s.io/external-dns/provider"
+	"sigs.k8s.io/external-dns/provider/webhook/api"
+
+	"external-dns-openstack-webhook/internal/tracing"
+)
+
+// webhookHandler serves the webhook API of external-dns like api.StartHTTPApi, but traces every request
+// and the provider calls below it
+func webhookHandler(p provider.Provider) http.Handler {
+	m := http.NewServeMux()
+	serve := func(pattern string, handler func(*api.WebhookServer, http.ResponseWriter, *http.Request)) {
+		m.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			handler(&api.WebhookServer{Provider: tracing.WithRequestContext(r.Context(), p)}, w, r)
+		})
+	}
+	serve("/", (*api.WebhookServer).NegotiateHandler)
+	serve(api.UrlRecords, (*api.WebhookServer).RecordsHandler)
+	serve(api.UrlAdjustEndpoints, (*api.WebhookServer).AdjustEndpointsHandler)
+
+	return otelhttp.NewHandler(m, "webhook", otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return r.Method + " " + r.URL.Path
+	}))
+}
+
+// startWebhookServer serves the webhook API on addr, signalling startedChan once it is listening
+func startWebhookServer(p provider.Provider, startedChan chan struct{}, addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	startedChan <- struct{}{}
+
+	s := &http.Server{
+		Addr:    addr,
+		Handler: webhookHandler(p),
+	}
+	return s.Serve(l)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"sigs.k8s.io/external-dns/provider"
+	"sigs.k8s.io/external-dns/provider/webhook/api"
+)
+
+type fakeProvider struct {
+	provider.BaseProvider
+	ctx context.Context
+}
+
+func (p *fakeProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
+	p.ctx = ctx
+	return []*endpoint.Endpoint{endpoint.NewEndpoint("www.example.com", endpoint.RecordTypeA, "10.1.1.1")}, nil
+}
+
+func (p *fakeProvider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
+	return nil
+}
+
+func TestWebhookHandlerTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	p := &fakeProvider{}
+	server := httptest.NewServer(webhookHandler(p))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+api.UrlRecords, nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d", resp.StatusCode)
+	}
+	if p.ctx == nil || p.ctx == context.Background() {
+		t.Fatal("provider was not called in the request context")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, expected 2", len(spans))
+	}
+	records, request := spans[0], spans[1]
+	if records.Name() != "Records" || request.Name() != "GET "+api.UrlRecords {
+		t.Errorf("unexpected spans %q and %q", records.Name(), request.Name())
+	}
+	if records.Parent().SpanID() != request.SpanContext().SpanID() {
+		t.Error("Records span is not a child of the request span")
+	}
+	if request.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace context of external-dns was not propagated, got trace %s", request.SpanContext().TraceID())
+	}
+}
+
+// blockingProvider blocks ApplyChanges until release is closed and reports the state of its context afterwards
+type blockingProvider struct {
+	provider.BaseProvider
+	started chan struct{}
+	release chan struct{}
+	result  chan error
+}
+
+func (p *blockingProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
+	return nil, nil
+}
+
+func (p *blockingProvider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
+	close(p.started)
+	<-p.release
+	p.result <- ctx.Err()
+	return nil
+}
+
+func TestWebhookHandlerRequestCancellation(t *testing.T) {
+	p := &blockingProvider{started: make(chan struct{}), release: make(chan struct{}), result: make(chan error, 1)}
+	handler := webhookHandler(p)
+	requestContexts := make(chan context.Context, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestContexts <- r.Context()
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+api.UrlRecords, strings.NewReader(`{"Create":[]}`))
+	req.Header.Set(api.ContentTypeHeader, api.MediaTypeFormatAndVersion)
+	go func() {
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	<-p.started
+	cancel()
+	select {
+	case <-(<-requestContexts).Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("request context was not cancelled by the client")
+	}
+	close(p.release)
+	if err := <-p.result; err != nil {
+		t.Errorf("ApplyChanges was cancelled with the request: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// actions recorded in the audit log
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// results recorded in the audit log
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	ResultDryRun  = "dry-run"
+)
+
+// Entry is a single change applied to Designate, written as one JSON line
+type Entry struct {
+	Timestamp   time.Time `json:"timestamp"`
+	Action      string    `json:"action"`
+	ZoneID      string    `json:"zone_id"`
+	Zone        string    `json:"zone,omitempty"`
+	Name        string    `json:"name"`
+	Type        string    `json:"type"`
+	RecordSetID string    `json:"recordset_id,omitempty"`
+	OldRecords  []string  `json:"old_records"`
+	NewRecords  []string  `json:"new_records"`
+	TTL         int       `json:"ttl"`
+	Result      string    `json:"result"`
+	Error       string    `json:"error,omitempty"`
+	Rollback    bool      `json:"rollback,omitempty"`
+	Duration    float64   `json:"duration_seconds"`
+}
+
+// Logger appends audit entries to a file or stream. A nil *Logger discards all entries.
+type Logger struct {
+	mu     sync.Mutex
+	enc    *json.Encoder
+	closer io.Closer
+}
+
+// NewLogger creates a Logger writing to the given path, which is created if needed and only ever appended to.
+// The special paths "-" and "stdout" write to the standard output.
+func NewLogger(path string) (*Logger, error) {
+	if path == "-" || path == "stdout" {
+		return NewStreamLogger(os.Stdout), nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	l := NewStreamLogger(f)
+	l.closer = f
+	return l, nil
+}
+
+// NewStreamLogger creates a Logger writing to w
+func NewStreamLogger(w io.Writer) *Logger {
+	return &Logger{enc: json.NewEncoder(w)}
+}
+
+// Log writes a single entry. Failures to write are logged, but never fail the change itself.
+func (l *Logger) Log(e Entry) {
+	if l == nil {
+		return
+	}
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	e.Timestamp = e.Timestamp.UTC()
+	if e.OldRecords == nil {
+		e.OldRecords = []string{}
+	}
+	if e.NewRecords == nil {
+		e.NewRecords = []string{}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.enc.Encode(e); err != nil {
+		log.Errorf("Failed to write audit log entry for %s/%s: %v", e.Name, e.Type, err)
+	}
+}
+
+// Close closes the underlying file, if any
+func (l *Logger) Close() error {
+	if l == nil || l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
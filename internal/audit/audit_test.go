@@ -0,0 +1,70 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoggerAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	for i := 0; i < 2; i++ {
+		l, err := NewLogger(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l.Log(Entry{Action: ActionCreate, Name: "www.example.com.", Type: "A", NewRecords: []string{"10.1.1.1"}, Result: ResultSuccess})
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines++
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid audit log line %q: %v", scanner.Text(), err)
+		}
+		if e.Timestamp.IsZero() || e.OldRecords == nil || e.Name != "www.example.com." {
+			t.Errorf("unexpected audit log entry %+v", e)
+		}
+	}
+	if lines != 2 {
+		t.Errorf("got %d audit log lines, want 2", lines)
+	}
+}
+
+func TestNilLogger(t *testing.T) {
+	var l *Logger
+	l.Log(Entry{})
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -19,11 +19,15 @@ package client
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
+	"sort"
 	"time"
 
 	"external-dns-openstack-webhook/internal/metrics"
+	"external-dns-openstack-webhook/internal/tracing"
 
 	"github.com/gophercloud/gophercloud/v2"
 	"github.com/gophercloud/gophercloud/v2/openstack"
@@ -34,6 +38,9 @@ import (
 	"github.com/gophercloud/gophercloud/v2/pagination"
 	"github.com/gophercloud/utils/v2/client"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // interface between provider and OpenStack DNS API
@@ -52,6 +59,12 @@ type DesignateClientInterface interface {
 
 	// DeleteRecordSet deletes recordset in the given DNS zone
 	DeleteRecordSet(ctx context.Context, zoneID, recordSetID string) error
+
+	// CreateZone creates a new DNS zone
+	CreateZone(ctx context.Context, opts zones.CreateOpts) (*zones.Zone, error)
+
+	// ListNameservers returns the hostnames of the nameservers serving the given DNS zone
+	ListNameservers(ctx context.Context, zoneID string) ([]string, error)
 }
 
 // implementation of the DesignateClientInterface
@@ -60,21 +73,38 @@ type designateClient struct {
 }
 
 // factory function for the DesignateClientInterface
-func NewDesignateClient() (DesignateClientInterface, error) {
-	serviceClient, err := createDesignateServiceClient()
+func NewDesignateClient(cfg Config) (DesignateClientInterface, error) {
+	serviceClient, err := createDesignateServiceClient(cfg)
 	if err != nil {
 		return nil, err
 	}
+	if cfg.Faults != nil {
+		log.Warnf("Injecting faults into the calls to Designate, never use this in production")
+		return NewFaultInjectingClient(&designateClient{serviceClient}, *cfg.Faults), nil
+	}
 	return &designateClient{serviceClient}, nil
 }
 
 // authenticate in OpenStack and obtain Designate service endpoint
-func createDesignateServiceClient() (*gophercloud.ServiceClient, error) {
+func createDesignateServiceClient(cfg Config) (*gophercloud.ServiceClient, error) {
 	ctx := context.Background()
 
-	authOptions, endpointOptions, tlsConfig, err := clouds.Parse()
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid OpenStack configuration: %w", err)
+	}
+	parseOptions := cfg.parseOptions()
+	if cfg.SecureYAML != "" {
+		f, err := os.Open(cfg.SecureYAML)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open secure.yaml file %s: %w", cfg.SecureYAML, err)
+		}
+		defer f.Close()
+		parseOptions = append(parseOptions, clouds.WithSecureYAML(f))
+	}
+
+	authOptions, endpointOptions, tlsConfig, err := clouds.Parse(parseOptions...)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to load OpenStack cloud configuration: %w", err)
 	}
 	authOptions.AllowReauth = true
 
@@ -92,6 +122,8 @@ func createDesignateServiceClient() (*gophercloud.ServiceClient, error) {
 			},
 		}
 	}
+	// trace all OpenStack API requests, keeping the TLS configuration of the transport
+	providerClient.HTTPClient.Transport = otelhttp.NewTransport(providerClient.HTTPClient.Transport)
 	log.Infof("Using OpenStack Keystone at %s", providerClient.IdentityEndpoint)
 
 	client, err := openstack.NewDNSV2(providerClient, endpointOptions)
@@ -106,29 +138,32 @@ func createDesignateServiceClient() (*gophercloud.ServiceClient, error) {
 // If filters is non-empty, one API call per filter value is made using the ?name= query param
 // (server-side filtering).
 func (c designateClient) ForEachZone(ctx context.Context, filters []string, handler func(zone *zones.Zone) error) error {
+	ctx, span := tracing.Tracer().Start(ctx, "designate.ForEachZone")
 	startTime := time.Now()
 	var pageCount int
 	var zoneCount int
+	handlerFailed := false
 
 	doList := func(opts zones.ListOpts) error {
 		pager := zones.List(c.serviceClient, opts)
 		return pager.EachPage(ctx,
 			func(ctx context.Context, page pagination.Page) (bool, error) {
 				pageCount++
-				metrics.TotalApiCalls.Inc()
-
 				list, err := zones.ExtractZones(page)
 				if err != nil {
 					return false, err
 				}
+				countAPICall("ForEachZone", nil)
 
 				zoneCount += len(list)
+				span.AddEvent("page", trace.WithAttributes(attribute.Int("designate.zone_count", len(list))))
 
-			for _, zone := range list {
-				if err := handler(&zone); err != nil {
-					return false, err
+				for _, zone := range list {
+					if err := handler(&zone); err != nil {
+						handlerFailed = true
+						return false, err
+					}
 				}
-			}
 				return true, nil
 			},
 		)
@@ -149,39 +184,46 @@ func (c designateClient) ForEachZone(ctx context.Context, filters []string, hand
 	metrics.ApiCallLatency.WithLabelValues("ForEachZone").Observe(duration.Seconds())
 
 	if err != nil {
-		metrics.FailedApiCallsTotal.Inc()
+		if !handlerFailed {
+			countAPICall("ForEachZone", err)
+		}
 		log.Errorf("ForEachZone failed after %v: %v", duration, err)
 	} else {
 		log.Debugf("✓ ForEachZone completed: %d zones across %d pages in %v", zoneCount, pageCount, duration)
 	}
+	span.SetAttributes(attribute.Int("designate.zone_count", zoneCount), attribute.Int("designate.page_count", pageCount))
+	tracing.End(span, err)
 
 	return err
 }
 
 // ForEachRecordSet calls handler for each recordset in the given DNS zone
 func (c designateClient) ForEachRecordSet(ctx context.Context, zoneID string, handler func(recordSet *recordsets.RecordSet) error) error {
+	ctx, span := tracing.Tracer().Start(ctx, "designate.ForEachRecordSet", trace.WithAttributes(attribute.String("designate.zone_id", zoneID)))
 	startTime := time.Now()
 
 	pager := recordsets.ListByZone(c.serviceClient, zoneID, recordsets.ListOpts{})
 	var pageCount int
 	var recordCount int
+	handlerFailed := false
 
 	err := pager.EachPage(ctx,
 		func(ctx context.Context, page pagination.Page) (bool, error) {
 			// Each page corresponds to a separate API call.
 			pageCount++
-			metrics.TotalApiCalls.Inc()
-
 			list, err := recordsets.ExtractRecordSets(page)
 			if err != nil {
 				return false, err
 			}
+			countAPICall("ForEachRecordSet", nil)
 
 			recordCount += len(list)
+			span.AddEvent("page", trace.WithAttributes(attribute.Int("designate.recordset_count", len(list))))
 
 			for _, recordSet := range list {
 				err := handler(&recordSet)
 				if err != nil {
+					handlerFailed = true
 					return false, err
 				}
 			}
@@ -193,19 +235,29 @@ func (c designateClient) ForEachRecordSet(ctx context.Context, zoneID string, ha
 	metrics.ApiCallLatency.WithLabelValues("ForEachRecordSet").Observe(duration.Seconds())
 
 	if err != nil {
-		metrics.FailedApiCallsTotal.Inc()
+		if !handlerFailed {
+			countAPICall("ForEachRecordSet", err)
+		}
 		log.Errorf("ForEachRecordSet failed for zone %s after %v: %v", zoneID, duration, err)
 	} else {
 		log.Debugf("✓ ForEachRecordSet zone=%s: %d records across %d pages in %v", zoneID, recordCount, pageCount, duration)
 	}
+	span.SetAttributes(attribute.Int("designate.recordset_count", recordCount), attribute.Int("designate.page_count", pageCount))
+	tracing.End(span, err)
 
 	return err
 }
 
 // CreateRecordSet creates recordset in the given DNS zone
-func (c designateClient) CreateRecordSet(ctx context.Context, zoneID string, opts recordsets.CreateOpts) (string, error) {
+func (c designateClient) CreateRecordSet(ctx context.Context, zoneID string, opts recordsets.CreateOpts) (_ string, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "designate.CreateRecordSet", trace.WithAttributes(
+		attribute.String("designate.zone_id", zoneID),
+		attribute.String("designate.recordset_name", opts.Name),
+		attribute.String("designate.recordset_type", opts.Type),
+		attribute.Int("designate.record_count", len(opts.Records)),
+	))
+	defer func() { tracing.End(span, err) }()
 	startTime := time.Now()
-	metrics.TotalApiCalls.Inc()
 
 	log.Debugf("→ Creating recordset: %s (%s) with %d targets", opts.Name, opts.Type, len(opts.Records))
 
@@ -213,21 +265,27 @@ func (c designateClient) CreateRecordSet(ctx context.Context, zoneID string, opt
 
 	duration := time.Since(startTime)
 	metrics.ApiCallLatency.WithLabelValues("CreateRecordSet").Observe(duration.Seconds())
+	countAPICall("CreateRecordSet", err)
 
 	if err != nil {
-		metrics.FailedApiCallsTotal.Inc()
 		log.Errorf("✗ CreateRecordSet failed for %s after %v: %v", opts.Name, duration, err)
 		return "", err
 	}
 
+	span.SetAttributes(attribute.String("designate.recordset_id", r.ID))
 	log.Debugf("✓ CreateRecordSet successful: %s (ID: %s) in %v", opts.Name, r.ID, duration)
 	return r.ID, nil
 }
 
 // UpdateRecordSet updates recordset in the given DNS zone
-func (c designateClient) UpdateRecordSet(ctx context.Context, zoneID, recordSetID string, opts recordsets.UpdateOpts) error {
+func (c designateClient) UpdateRecordSet(ctx context.Context, zoneID, recordSetID string, opts recordsets.UpdateOpts) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "designate.UpdateRecordSet", trace.WithAttributes(
+		attribute.String("designate.zone_id", zoneID),
+		attribute.String("designate.recordset_id", recordSetID),
+		attribute.Int("designate.record_count", len(opts.Records)),
+	))
+	defer func() { tracing.End(span, err) }()
 	startTime := time.Now()
-	metrics.TotalApiCalls.Inc()
 
 	recordCount := 0
 	if opts.Records != nil {
@@ -235,13 +293,13 @@ func (c designateClient) UpdateRecordSet(ctx context.Context, zoneID, recordSetI
 	}
 	log.Debugf("→ Updating recordset: %s with %d targets", recordSetID, recordCount)
 
-	_, err := recordsets.Update(ctx, c.serviceClient, zoneID, recordSetID, opts).Extract()
+	_, err = recordsets.Update(ctx, c.serviceClient, zoneID, recordSetID, opts).Extract()
 
 	duration := time.Since(startTime)
 	metrics.ApiCallLatency.WithLabelValues("UpdateRecordSet").Observe(duration.Seconds())
+	countAPICall("UpdateRecordSet", err)
 
 	if err != nil {
-		metrics.FailedApiCallsTotal.Inc()
 		log.Errorf("✗ UpdateRecordSet failed for %s after %v: %v", recordSetID, duration, err)
 	} else {
 		log.Debugf("✓ UpdateRecordSet successful: %s in %v", recordSetID, duration)
@@ -251,19 +309,23 @@ func (c designateClient) UpdateRecordSet(ctx context.Context, zoneID, recordSetI
 }
 
 // DeleteRecordSet deletes recordset in the given DNS zone
-func (c designateClient) DeleteRecordSet(ctx context.Context, zoneID, recordSetID string) error {
+func (c designateClient) DeleteRecordSet(ctx context.Context, zoneID, recordSetID string) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "designate.DeleteRecordSet", trace.WithAttributes(
+		attribute.String("designate.zone_id", zoneID),
+		attribute.String("designate.recordset_id", recordSetID),
+	))
+	defer func() { tracing.End(span, err) }()
 	startTime := time.Now()
-	metrics.TotalApiCalls.Inc()
 
 	log.Debugf("→ Deleting recordset: %s", recordSetID)
 
-	err := recordsets.Delete(ctx, c.serviceClient, zoneID, recordSetID).ExtractErr()
+	err = recordsets.Delete(ctx, c.serviceClient, zoneID, recordSetID).ExtractErr()
 
 	duration := time.Since(startTime)
 	metrics.ApiCallLatency.WithLabelValues("DeleteRecordSet").Observe(duration.Seconds())
+	countAPICall("DeleteRecordSet", err)
 
 	if err != nil {
-		metrics.FailedApiCallsTotal.Inc()
 		log.Errorf("✗ DeleteRecordSet failed for %s after %v: %v", recordSetID, duration, err)
 	} else {
 		log.Debugf("✓ DeleteRecordSet successful: %s in %v", recordSetID, duration)
@@ -271,3 +333,83 @@ func (c designateClient) DeleteRecordSet(ctx context.Context, zoneID, recordSetI
 
 	return err
 }
+
+// CreateZone creates a new DNS zone
+func (c designateClient) CreateZone(ctx context.Context, opts zones.CreateOpts) (_ *zones.Zone, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "designate.CreateZone", trace.WithAttributes(attribute.String("designate.zone_name", opts.Name)))
+	defer func() { tracing.End(span, err) }()
+	startTime := time.Now()
+
+	log.Debugf("→ Creating zone: %s", opts.Name)
+
+	zone, err := zones.Create(ctx, c.serviceClient, opts).Extract()
+
+	duration := time.Since(startTime)
+	metrics.ApiCallLatency.WithLabelValues("CreateZone").Observe(duration.Seconds())
+	countAPICall("CreateZone", err)
+
+	if err != nil {
+		log.Errorf("✗ CreateZone failed for %s after %v: %v", opts.Name, duration, err)
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.String("designate.zone_id", zone.ID))
+	log.Debugf("✓ CreateZone successful: %s (ID: %s) in %v", opts.Name, zone.ID, duration)
+	return zone, nil
+}
+
+// ListNameservers returns the hostnames of the nameservers serving the given DNS zone, ordered by priority
+func (c designateClient) ListNameservers(ctx context.Context, zoneID string) (_ []string, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "designate.ListNameservers", trace.WithAttributes(attribute.String("designate.zone_id", zoneID)))
+	defer func() { tracing.End(span, err) }()
+	startTime := time.Now()
+
+	var body struct {
+		Nameservers []struct {
+			Hostname string `json:"hostname"`
+			Priority int    `json:"priority"`
+		} `json:"nameservers"`
+	}
+	_, err = c.serviceClient.Get(ctx, c.serviceClient.ServiceURL("zones", zoneID, "nameservers"), &body, nil)
+
+	duration := time.Since(startTime)
+	metrics.ApiCallLatency.WithLabelValues("ListNameservers").Observe(duration.Seconds())
+	countAPICall("ListNameservers", err)
+
+	if err != nil {
+		log.Errorf("✗ ListNameservers failed for zone %s after %v: %v", zoneID, duration, err)
+		return nil, err
+	}
+
+	sort.SliceStable(body.Nameservers, func(i, j int) bool {
+		return body.Nameservers[i].Priority < body.Nameservers[j].Priority
+	})
+	var result []string
+	for _, ns := range body.Nameservers {
+		result = append(result, ns.Hostname)
+	}
+	log.Debugf("✓ ListNameservers zone=%s: %d nameservers in %v", zoneID, len(result), duration)
+	return result, nil
+}
+
+// countAPICall counts a call of an API method by the status class of its response
+func countAPICall(method string, err error) {
+	class := statusClass(err)
+	metrics.TotalApiCalls.WithLabelValues(method, class).Inc()
+	if err != nil {
+		metrics.FailedApiCallsTotal.WithLabelValues(method, class).Inc()
+	}
+}
+
+// statusClass returns the HTTP status class (e.g. 4xx) of the response that caused err,
+// "2xx" if there was no error and "error" if there was no response at all
+func statusClass(err error) string {
+	if err == nil {
+		return "2xx"
+	}
+	var statusErr interface{ GetStatusCode() int }
+	if errors.As(err, &statusErr) {
+		return fmt.Sprintf("%dxx", statusErr.GetStatusCode()/100)
+	}
+	return "error"
+}
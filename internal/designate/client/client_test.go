@@ -0,0 +1,263 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/dns/v2/recordsets"
+	"github.com/gophercloud/gophercloud/v2/openstack/dns/v2/zones"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"external-dns-openstack-webhook/internal/designate/fakeserver"
+	"external-dns-openstack-webhook/internal/metrics"
+)
+
+func TestStatusClass(t *testing.T) {
+	notFound := gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusNotFound}
+	for _, tc := range []struct {
+		err      error
+		expected string
+	}{
+		{nil, "2xx"},
+		{notFound, "4xx"},
+		{fmt.Errorf("wrapped: %w", gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusServiceUnavailable}), "5xx"},
+		{errors.New("connection refused"), "error"},
+	} {
+		if got := statusClass(tc.err); got != tc.expected {
+			t.Errorf("statusClass(%v) = %q, expected %q", tc.err, got, tc.expected)
+		}
+	}
+
+	before := testutil.ToFloat64(metrics.FailedApiCallsTotal.WithLabelValues("TestMethod", "4xx"))
+	countAPICall("TestMethod", notFound)
+	countAPICall("TestMethod", nil)
+	if got := testutil.ToFloat64(metrics.FailedApiCallsTotal.WithLabelValues("TestMethod", "4xx")) - before; got != 1 {
+		t.Errorf("got %v failed calls, expected 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.TotalApiCalls.WithLabelValues("TestMethod", "2xx")); got != 1 {
+		t.Errorf("got %v successful calls, expected 1", got)
+	}
+}
+
+func TestUnreadablePageCountsAsFailedCall(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"recordsets": [{"id": "rs-1", "ttl": "not a number"}], "links": {}}`)
+	}))
+	defer server.Close()
+	c := designateClient{serviceClient: &gophercloud.ServiceClient{
+		ProviderClient: &gophercloud.ProviderClient{HTTPClient: *server.Client()},
+		Endpoint:       server.URL + "/",
+	}}
+
+	succeeded := testutil.ToFloat64(metrics.TotalApiCalls.WithLabelValues("ForEachRecordSet", "2xx"))
+	failed := testutil.ToFloat64(metrics.FailedApiCallsTotal.WithLabelValues("ForEachRecordSet", "error"))
+	err := c.ForEachRecordSet(context.Background(), "zone-1", func(*recordsets.RecordSet) error { return nil })
+	if err == nil {
+		t.Fatal("expected an error extracting the page")
+	}
+	if got := testutil.ToFloat64(metrics.TotalApiCalls.WithLabelValues("ForEachRecordSet", "2xx")) - succeeded; got != 0 {
+		t.Errorf("got %v successful calls, expected none", got)
+	}
+	if got := testutil.ToFloat64(metrics.FailedApiCallsTotal.WithLabelValues("ForEachRecordSet", "error")) - failed; got != 1 {
+		t.Errorf("got %v failed calls, expected 1", got)
+	}
+}
+
+// newFakeServerClient starts a fake cloud and creates a client authenticated against it
+func newFakeServerClient(t *testing.T) (*fakeserver.Server, DesignateClientInterface) {
+	server := fakeserver.New()
+	t.Cleanup(server.Close)
+	cloudsYAML := filepath.Join(t.TempDir(), "clouds.yaml")
+	if err := server.WriteCloudsYAML(cloudsYAML); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewDesignateClient(Config{Cloud: fakeserver.CloudName, CloudsYAML: cloudsYAML})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, c
+}
+
+// countRequests counts the received requests with the given method and path prefix
+func countRequests(server *fakeserver.Server, method, path string) int {
+	count := 0
+	for _, r := range server.Requests() {
+		if strings.HasPrefix(r, method+" "+path) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestFakeServerZonePagination(t *testing.T) {
+	server, c := newFakeServerClient(t)
+	server.PageSize = 2
+	ctx := context.Background()
+	for _, name := range []string{"a.example.", "b.example.", "c.example.", "d.example.", "e.example."} {
+		server.AddZone(name)
+	}
+
+	var names []string
+	err := c.ForEachZone(ctx, nil, func(zone *zones.Zone) error {
+		names = append(names, zone.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 5 {
+		t.Errorf("got zones %v, expected 5", names)
+	}
+	if got := countRequests(server, http.MethodGet, "/dns/v2/zones"); got != 3 {
+		t.Errorf("got %d page requests, expected 3", got)
+	}
+
+	names = nil
+	err = c.ForEachZone(ctx, []string{"c.example", "e.example"}, func(zone *zones.Zone) error {
+		names = append(names, zone.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"c.example.", "e.example."}) {
+		t.Errorf("got filtered zones %v", names)
+	}
+}
+
+func TestFakeServerRecordSets(t *testing.T) {
+	server, c := newFakeServerClient(t)
+	server.PageSize = 1
+	ctx := context.Background()
+	zoneID := server.AddZone("example.com.")
+
+	id, err := c.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{Name: "www.example.com.", Type: "A", TTL: 300, Records: []string{"10.0.0.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ttl := 600
+	if err := c.UpdateRecordSet(ctx, zoneID, id, recordsets.UpdateOpts{Records: []string{"10.0.0.2", "10.0.0.3"}, TTL: &ttl}); err != nil {
+		t.Fatal(err)
+	}
+	ftpID, err := c.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{Name: "ftp.example.com.", Type: "CNAME", Records: []string{"www.example.com."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteRecordSet(ctx, zoneID, ftpID); err != nil {
+		t.Fatal(err)
+	}
+
+	var listed []string
+	err = c.ForEachRecordSet(ctx, zoneID, func(rs *recordsets.RecordSet) error {
+		if rs.Status != "ACTIVE" {
+			t.Errorf("recordset %s/%s is %s", rs.Name, rs.Type, rs.Status)
+		}
+		listed = append(listed, fmt.Sprintf("%s %s %d %s", rs.Name, rs.Type, rs.TTL, strings.Join(rs.Records, ",")))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(listed)
+	if len(listed) != 3 || listed[0] != "example.com. NS 0 ns1.fake.test.,ns2.fake.test." ||
+		!strings.HasPrefix(listed[1], "example.com. SOA") || listed[2] != "www.example.com. A 600 10.0.0.2,10.0.0.3" {
+		t.Errorf("got recordsets %v", listed)
+	}
+	if got := countRequests(server, http.MethodGet, "/dns/v2/zones/"+zoneID+"/recordsets"); got != 3 {
+		t.Errorf("got %d page requests, expected 3", got)
+	}
+
+	nameservers, err := c.ListNameservers(ctx, zoneID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(nameservers, []string{"ns1.fake.test.", "ns2.fake.test."}) {
+		t.Errorf("got nameservers %v", nameservers)
+	}
+}
+
+func TestFakeServerCreateZone(t *testing.T) {
+	server, c := newFakeServerClient(t)
+	ctx := context.Background()
+
+	zone, err := c.CreateZone(ctx, zones.CreateOpts{Name: "new.example.", Email: "dns@example.com", TTL: 300})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zone.Status != "PENDING" || zone.TTL != 300 {
+		t.Errorf("unexpected created zone %+v", zone)
+	}
+	err = c.ForEachZone(ctx, []string{"new.example"}, func(z *zones.Zone) error {
+		if z.ID != zone.ID || z.Status != "ACTIVE" {
+			t.Errorf("unexpected listed zone %+v", z)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(server.RecordSets(zone.ID)) != 2 {
+		t.Errorf("expected SOA and NS recordsets, got %v", server.RecordSets(zone.ID))
+	}
+}
+
+func TestFakeServerErrors(t *testing.T) {
+	server, c := newFakeServerClient(t)
+	ctx := context.Background()
+	zoneID := server.AddZone("example.com.")
+	server.AddRecordSet(zoneID, "www.example.com.", "A", 300, "10.0.0.1")
+
+	_, err := c.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{Name: "www.example.com.", Type: "A", Records: []string{"10.0.0.2"}})
+	if got := statusClass(err); got != "4xx" || !gophercloud.ResponseCodeIs(err, http.StatusConflict) {
+		t.Errorf("duplicate recordset: got %v (%s), expected a conflict", err, got)
+	}
+	err = c.DeleteRecordSet(ctx, zoneID, "unknown")
+	if !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		t.Errorf("unknown recordset: got %v, expected not found", err)
+	}
+
+	server.Fail(http.MethodGet, "/recordsets", http.StatusServiceUnavailable, 1)
+	before := testutil.ToFloat64(metrics.FailedApiCallsTotal.WithLabelValues("ForEachRecordSet", "5xx"))
+	err = c.ForEachRecordSet(ctx, zoneID, func(*recordsets.RecordSet) error { return nil })
+	if !gophercloud.ResponseCodeIs(err, http.StatusServiceUnavailable) {
+		t.Errorf("injected failure: got %v, expected service unavailable", err)
+	}
+	if got := testutil.ToFloat64(metrics.FailedApiCallsTotal.WithLabelValues("ForEachRecordSet", "5xx")) - before; got != 1 {
+		t.Errorf("got %v failed calls counted, expected 1", got)
+	}
+
+	// expired tokens are renewed transparently
+	server.RevokeTokens()
+	if err := c.ForEachRecordSet(ctx, zoneID, func(*recordsets.RecordSet) error { return nil }); err != nil {
+		t.Errorf("listing after revoking tokens failed: %v", err)
+	}
+	if got := countRequests(server, http.MethodPost, "/identity/v3/auth/tokens"); got != 2 {
+		t.Errorf("got %d authentications, expected 2", got)
+	}
+}
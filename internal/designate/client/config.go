@@ -0,0 +1,109 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/config/clouds"
+)
+
+// valid values for the endpoint interface, see gophercloud.Availability
+var validInterfaces = []string{"public", "internal", "admin"}
+
+// Config selects the cloud from clouds.yaml that is used to talk to OpenStack.
+// Empty fields fall back to the OS_CLOUD, OS_CLIENT_CONFIG_FILE, OS_REGION_NAME and
+// OS_INTERFACE environment variables and the standard clouds.yaml locations.
+type Config struct {
+	// name of the cloud entry in clouds.yaml
+	Cloud string
+	// path to the clouds.yaml file
+	CloudsYAML string
+	// path to the secure.yaml file complementing clouds.yaml
+	SecureYAML string
+	// region to look up the Designate endpoint in
+	Region string
+	// endpoint interface to use (public, internal or admin)
+	Interface string
+	// faults injected into the calls to Designate if set, for testing only
+	Faults *FaultConfig
+}
+
+// Validate checks that the configured files are readable and the interface is known
+func (c Config) Validate() error {
+	if err := validateFile("clouds.yaml", c.CloudsYAML); err != nil {
+		return err
+	}
+	if err := validateFile("secure.yaml", c.SecureYAML); err != nil {
+		return err
+	}
+	if c.Interface != "" {
+		valid := false
+		for _, i := range validInterfaces {
+			if strings.EqualFold(c.Interface, i) {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("invalid interface %q: must be one of %s", c.Interface, strings.Join(validInterfaces, ", "))
+		}
+	}
+	return nil
+}
+
+// validateFile returns a descriptive error if an explicitly configured file cannot be used
+func validateFile(kind, path string) error {
+	if path == "" {
+		return nil
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s file %s does not exist", kind, path)
+		}
+		return fmt.Errorf("%s file %s cannot be accessed: %w", kind, path, err)
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("%s file %s is a directory", kind, path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%s file %s is not readable: %w", kind, path, err)
+	}
+	return f.Close()
+}
+
+// parseOptions converts the configuration into options for clouds.Parse
+func (c Config) parseOptions() []clouds.ParseOption {
+	var opts []clouds.ParseOption
+	if c.Cloud != "" {
+		opts = append(opts, clouds.WithCloudName(c.Cloud))
+	}
+	if c.CloudsYAML != "" {
+		opts = append(opts, clouds.WithLocations(c.CloudsYAML))
+	}
+	if c.Region != "" {
+		opts = append(opts, clouds.WithRegion(c.Region))
+	}
+	if c.Interface != "" {
+		opts = append(opts, clouds.WithEndpointType(strings.ToLower(c.Interface)))
+	}
+	return opts
+}
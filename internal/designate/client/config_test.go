@@ -0,0 +1,77 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+	dir := t.TempDir()
+	cloudsYAML := filepath.Join(dir, "clouds.yaml")
+	if err := os.WriteFile(cloudsYAML, []byte("clouds: {}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr string
+	}{
+		{
+			name:   "empty config",
+			config: Config{},
+		},
+		{
+			name:   "existing clouds.yaml",
+			config: Config{CloudsYAML: cloudsYAML, Interface: "Internal"},
+		},
+		{
+			name:    "missing clouds.yaml",
+			config:  Config{CloudsYAML: filepath.Join(dir, "missing.yaml")},
+			wantErr: "does not exist",
+		},
+		{
+			name:    "secure.yaml is a directory",
+			config:  Config{SecureYAML: dir},
+			wantErr: "is a directory",
+		},
+		{
+			name:    "invalid interface",
+			config:  Config{Interface: "private"},
+			wantErr: "invalid interface",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
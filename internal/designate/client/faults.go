@@ -0,0 +1,268 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/dns/v2/recordsets"
+	"github.com/gophercloud/gophercloud/v2/openstack/dns/v2/zones"
+	log "github.com/sirupsen/logrus"
+
+	"external-dns-openstack-webhook/internal/metrics"
+)
+
+// methods of the DesignateClientInterface, as used in metric labels
+var methods = []string{
+	"ForEachZone", "ForEachRecordSet", "CreateRecordSet", "UpdateRecordSet", "DeleteRecordSet", "CreateZone", "ListNameservers",
+}
+
+// kinds of injected faults, used as metric label
+const (
+	faultError      = "error"
+	faultConflict   = "conflict"
+	faultPagination = "pagination"
+)
+
+// FaultConfig configures the faults injected into the calls to Designate
+type FaultConfig struct {
+	// probability of a call failing with 503 Service Unavailable by method, the empty method applies to all others
+	ErrorRates map[string]float64
+	// probability of creates and updates failing with 409 Conflict
+	ConflictRate float64
+	// delay added to every call
+	Latency time.Duration
+	// probability of a listing failing after a part of the items was passed to the handler
+	PaginationFailureRate float64
+	// seed of the random faults, random if 0
+	Seed uint64
+}
+
+// ParseFaultConfig parses a comma separated list of faults like
+// "error-rate=0.1,error-rate.CreateRecordSet=0.5,conflict-rate=0.1,latency=200ms,pagination-failure-rate=0.2,seed=1"
+func ParseFaultConfig(spec string) (FaultConfig, error) {
+	config := FaultConfig{ErrorRates: map[string]float64{}}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return FaultConfig{}, fmt.Errorf("fault %q is not of the form key=value", item)
+		}
+		var err error
+		switch name, method, _ := strings.Cut(key, "."); name {
+		case "error-rate":
+			if method != "" && !slices.Contains(methods, method) {
+				return FaultConfig{}, fmt.Errorf("unknown method %q, must be one of %s", method, strings.Join(methods, ", "))
+			}
+			config.ErrorRates[method], err = parseRate(value)
+		case "conflict-rate":
+			config.ConflictRate, err = parseRate(value)
+		case "pagination-failure-rate":
+			config.PaginationFailureRate, err = parseRate(value)
+		case "latency":
+			config.Latency, err = time.ParseDuration(value)
+		case "seed":
+			config.Seed, err = strconv.ParseUint(value, 10, 64)
+		default:
+			return FaultConfig{}, fmt.Errorf("unknown fault %q", key)
+		}
+		if err != nil {
+			return FaultConfig{}, fmt.Errorf("invalid value of fault %q: %w", key, err)
+		}
+	}
+	return config, nil
+}
+
+func parseRate(value string) (float64, error) {
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("rate %v is not between 0 and 1", rate)
+	}
+	return rate, nil
+}
+
+// faultInjectingClient decorates a DesignateClientInterface, injecting faults into its calls
+type faultInjectingClient struct {
+	client DesignateClientInterface
+	config FaultConfig
+
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// NewFaultInjectingClient wraps client to inject the configured faults, for testing alerting and error handling.
+// Injected faults are counted as failed API calls, like the responses of Designate they imitate.
+func NewFaultInjectingClient(client DesignateClientInterface, config FaultConfig) DesignateClientInterface {
+	seed := config.Seed
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	return &faultInjectingClient{client: client, config: config, rng: rand.New(rand.NewPCG(seed, seed))}
+}
+
+// chance returns true with probability p
+func (c *faultInjectingClient) chance(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rng.Float64() < p
+}
+
+func (c *faultInjectingClient) errorRate(method string) float64 {
+	if rate, ok := c.config.ErrorRates[method]; ok {
+		return rate
+	}
+	return c.config.ErrorRates[""]
+}
+
+// inject counts the fault and returns the error of the Designate response it imitates
+func (c *faultInjectingClient) inject(method, fault string, status int) error {
+	log.Debugf("Injecting %s fault into %s", fault, method)
+	metrics.InjectedFaultsTotal.WithLabelValues(method, fault).Inc()
+	err := gophercloud.ErrUnexpectedResponseCode{
+		Method: method,
+		URL:    "fault-injection",
+		Actual: status,
+		Body:   []byte("injected " + fault + " fault"),
+	}
+	countAPICall(method, err)
+	return err
+}
+
+// before delays a call and returns the fault to inject into it, if any. Only writes may conflict.
+func (c *faultInjectingClient) before(ctx context.Context, method string, write bool) error {
+	if c.config.Latency > 0 {
+		select {
+		case <-time.After(c.config.Latency):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if c.chance(c.errorRate(method)) {
+		return c.inject(method, faultError, http.StatusServiceUnavailable)
+	}
+	if write && c.chance(c.config.ConflictRate) {
+		return c.inject(method, faultConflict, http.StatusConflict)
+	}
+	return nil
+}
+
+// partialListing fails a listing after a random part of its items was passed to the handler
+type partialListing struct {
+	c      *faultInjectingClient
+	method string
+	fail   bool
+}
+
+func (c *faultInjectingClient) listing(method string) *partialListing {
+	return &partialListing{c: c, method: method, fail: c.chance(c.config.PaginationFailureRate)}
+}
+
+// next returns the fault to inject before the next item, if any
+func (l *partialListing) next() error {
+	if !l.fail || !l.c.chance(0.5) {
+		return nil
+	}
+	l.fail = false
+	return l.c.inject(l.method, faultPagination, http.StatusServiceUnavailable)
+}
+
+// end returns the result of the listing, failing it if the fault was not injected before any item
+func (l *partialListing) end(err error) error {
+	if err == nil && l.fail {
+		return l.c.inject(l.method, faultPagination, http.StatusServiceUnavailable)
+	}
+	return err
+}
+
+func (c *faultInjectingClient) ForEachZone(ctx context.Context, filters []string, handler func(zone *zones.Zone) error) error {
+	if err := c.before(ctx, "ForEachZone", false); err != nil {
+		return err
+	}
+	l := c.listing("ForEachZone")
+	return l.end(c.client.ForEachZone(ctx, filters, func(zone *zones.Zone) error {
+		if err := l.next(); err != nil {
+			return err
+		}
+		return handler(zone)
+	}))
+}
+
+func (c *faultInjectingClient) ForEachRecordSet(ctx context.Context, zoneID string, handler func(recordSet *recordsets.RecordSet) error) error {
+	if err := c.before(ctx, "ForEachRecordSet", false); err != nil {
+		return err
+	}
+	l := c.listing("ForEachRecordSet")
+	return l.end(c.client.ForEachRecordSet(ctx, zoneID, func(recordSet *recordsets.RecordSet) error {
+		if err := l.next(); err != nil {
+			return err
+		}
+		return handler(recordSet)
+	}))
+}
+
+func (c *faultInjectingClient) CreateRecordSet(ctx context.Context, zoneID string, opts recordsets.CreateOpts) (string, error) {
+	if err := c.before(ctx, "CreateRecordSet", true); err != nil {
+		return "", err
+	}
+	return c.client.CreateRecordSet(ctx, zoneID, opts)
+}
+
+func (c *faultInjectingClient) UpdateRecordSet(ctx context.Context, zoneID, recordSetID string, opts recordsets.UpdateOpts) error {
+	if err := c.before(ctx, "UpdateRecordSet", true); err != nil {
+		return err
+	}
+	return c.client.UpdateRecordSet(ctx, zoneID, recordSetID, opts)
+}
+
+func (c *faultInjectingClient) DeleteRecordSet(ctx context.Context, zoneID, recordSetID string) error {
+	if err := c.before(ctx, "DeleteRecordSet", false); err != nil {
+		return err
+	}
+	return c.client.DeleteRecordSet(ctx, zoneID, recordSetID)
+}
+
+func (c *faultInjectingClient) CreateZone(ctx context.Context, opts zones.CreateOpts) (*zones.Zone, error) {
+	if err := c.before(ctx, "CreateZone", true); err != nil {
+		return nil, err
+	}
+	return c.client.CreateZone(ctx, opts)
+}
+
+func (c *faultInjectingClient) ListNameservers(ctx context.Context, zoneID string) ([]string, error) {
+	if err := c.before(ctx, "ListNameservers", false); err != nil {
+		return nil, err
+	}
+	return c.client.ListNameservers(ctx, zoneID)
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/dns/v2/recordsets"
+	"github.com/gophercloud/gophercloud/v2/openstack/dns/v2/zones"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"external-dns-openstack-webhook/internal/designate/fakeserver"
+	"external-dns-openstack-webhook/internal/metrics"
+)
+
+func TestParseFaultConfig(t *testing.T) {
+	config, err := ParseFaultConfig("error-rate=0.1, error-rate.CreateRecordSet=1,conflict-rate=0.25,latency=200ms,pagination-failure-rate=0.5,seed=7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := FaultConfig{
+		ErrorRates:            map[string]float64{"": 0.1, "CreateRecordSet": 1},
+		ConflictRate:          0.25,
+		Latency:               200 * time.Millisecond,
+		PaginationFailureRate: 0.5,
+		Seed:                  7,
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("got %+v, expected %+v", config, expected)
+	}
+
+	for _, spec := range []string{"error-rate", "error-rate=1.5", "error-rate.Records=0.1", "conflict-rate=x", "latency=5", "timeout=1s"} {
+		if _, err := ParseFaultConfig(spec); err == nil {
+			t.Errorf("expected error for %q", spec)
+		}
+	}
+}
+
+func TestFaultInjectingClient(t *testing.T) {
+	server, c := newFakeServerClient(t)
+	server.PageSize = 2
+	zoneID := server.AddZone("example.com.")
+	for i := range 6 {
+		server.AddRecordSet(zoneID, fmt.Sprintf("www%d.example.com.", i), "A", 300, "10.0.0.1")
+	}
+	ctx := context.Background()
+	injected := func(method, fault string) float64 {
+		return testutil.ToFloat64(metrics.InjectedFaultsTotal.WithLabelValues(method, fault))
+	}
+
+	// errors of a single method are counted as failed API calls
+	faulty := NewFaultInjectingClient(c, FaultConfig{ErrorRates: map[string]float64{"CreateRecordSet": 1}, Seed: 1})
+	failedBefore := testutil.ToFloat64(metrics.FailedApiCallsTotal.WithLabelValues("CreateRecordSet", "5xx"))
+	injectedBefore := injected("CreateRecordSet", faultError)
+	_, err := faulty.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{Name: "new.example.com.", Type: "A", Records: []string{"10.0.0.2"}})
+	if !gophercloud.ResponseCodeIs(err, http.StatusServiceUnavailable) {
+		t.Errorf("expected 503, got %v", err)
+	}
+	if got := testutil.ToFloat64(metrics.FailedApiCallsTotal.WithLabelValues("CreateRecordSet", "5xx")) - failedBefore; got != 1 {
+		t.Errorf("got %v failed API calls, expected 1", got)
+	}
+	if got := injected("CreateRecordSet", faultError) - injectedBefore; got != 1 {
+		t.Errorf("got %v injected faults, expected 1", got)
+	}
+	if len(server.RecordSets(zoneID)) != 8 {
+		t.Error("failed create reached Designate")
+	}
+	if err := faulty.ForEachZone(ctx, nil, func(*zones.Zone) error { return nil }); err != nil {
+		t.Errorf("unexpected error of another method: %v", err)
+	}
+
+	// only writes conflict
+	faulty = NewFaultInjectingClient(c, FaultConfig{ConflictRate: 1, Seed: 1})
+	recordSetID := server.RecordSets(zoneID)[2].ID
+	ttl := 60
+	if err := faulty.UpdateRecordSet(ctx, zoneID, recordSetID, recordsets.UpdateOpts{TTL: &ttl}); !gophercloud.ResponseCodeIs(err, http.StatusConflict) {
+		t.Errorf("expected 409, got %v", err)
+	}
+	if err := faulty.DeleteRecordSet(ctx, zoneID, server.RecordSets(zoneID)[7].ID); err != nil {
+		t.Errorf("unexpected error of delete: %v", err)
+	}
+
+	// listings fail after passing a part of the items to the handler
+	partial := false
+	for seed := range uint64(10) {
+		faulty = NewFaultInjectingClient(c, FaultConfig{PaginationFailureRate: 1, Seed: seed + 1})
+		var count int
+		err := faulty.ForEachRecordSet(ctx, zoneID, func(*recordsets.RecordSet) error {
+			count++
+			return nil
+		})
+		if !gophercloud.ResponseCodeIs(err, http.StatusServiceUnavailable) {
+			t.Fatalf("expected 503, got %v", err)
+		}
+		partial = partial || count > 0 && count < 7
+	}
+	if !partial {
+		t.Error("no listing failed after passing a part of the items")
+	}
+
+	// latency delays calls and respects their context
+	faulty = NewFaultInjectingClient(c, FaultConfig{Latency: 20 * time.Millisecond})
+	start := time.Now()
+	if _, err := faulty.ListNameservers(ctx, zoneID); err != nil || time.Since(start) < 20*time.Millisecond {
+		t.Errorf("call returned %v after %v, expected a delay of 20ms", err, time.Since(start))
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	if _, err := faulty.ListNameservers(timeoutCtx, zoneID); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestNewDesignateClientFaults(t *testing.T) {
+	server := fakeserver.New()
+	defer server.Close()
+	cloudsYAML := filepath.Join(t.TempDir(), "clouds.yaml")
+	if err := server.WriteCloudsYAML(cloudsYAML); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewDesignateClient(Config{Cloud: fakeserver.CloudName, CloudsYAML: cloudsYAML, Faults: &FaultConfig{ErrorRates: map[string]float64{"": 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ForEachZone(context.Background(), nil, func(*zones.Zone) error { return nil }); !gophercloud.ResponseCodeIs(err, http.StatusServiceUnavailable) {
+		t.Errorf("expected injected 503, got %v", err)
+	}
+}
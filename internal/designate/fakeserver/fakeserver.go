@@ -0,0 +1,663 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fakeserver implements a fake OpenStack cloud offering the Keystone v3 token API and the Designate v2 API
+// for zones and recordsets, so that the real client can be tested without a full OpenStack.
+package fakeserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// credentials and names of the fake cloud
+const (
+	CloudName   = "fake"
+	Username    = "admin"
+	Password    = "secret"
+	ProjectName = "demo"
+	Region      = "RegionOne"
+)
+
+// nameservers of all zones
+var nameservers = []string{"ns1.fake.test.", "ns2.fake.test."}
+
+// time format of the Designate API
+const timeFormat = "2006-01-02T15:04:05.000000"
+
+// statuses and actions of zones and recordsets
+const (
+	statusActive  = "ACTIVE"
+	statusPending = "PENDING"
+	actionNone    = "NONE"
+	actionCreate  = "CREATE"
+	actionUpdate  = "UPDATE"
+	actionDelete  = "DELETE"
+)
+
+type zone struct {
+	ID          string `json:"id"`
+	ProjectID   string `json:"project_id"`
+	Name        string `json:"name"`
+	Email       string `json:"email"`
+	Description string `json:"description"`
+	TTL         int    `json:"ttl"`
+	Serial      int    `json:"serial"`
+	Status      string `json:"status"`
+	Action      string `json:"action"`
+	Version     int    `json:"version"`
+	Type        string `json:"type"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at,omitempty"`
+}
+
+type recordSet struct {
+	ID          string   `json:"id"`
+	ZoneID      string   `json:"zone_id"`
+	ProjectID   string   `json:"project_id"`
+	Name        string   `json:"name"`
+	ZoneName    string   `json:"zone_name"`
+	Type        string   `json:"type"`
+	Records     []string `json:"records"`
+	TTL         *int     `json:"ttl"`
+	Status      string   `json:"status"`
+	Action      string   `json:"action"`
+	Description string   `json:"description"`
+	Version     int      `json:"version"`
+	CreatedAt   string   `json:"created_at"`
+	UpdatedAt   string   `json:"updated_at,omitempty"`
+}
+
+// RecordSet is the state of a recordset as stored by the server
+type RecordSet struct {
+	ID          string
+	Name        string
+	Type        string
+	TTL         int
+	Records     []string
+	Description string
+	Status      string
+}
+
+// injected failure of requests
+type failure struct {
+	method    string
+	path      string
+	status    int
+	remaining int
+}
+
+// Server is a fake OpenStack cloud. Objects written through the API are PENDING in the response to the write and
+// ACTIVE from the next request on, like Designate processes changes asynchronously.
+type Server struct {
+	*httptest.Server
+
+	// PageSize is the maximum number of zones or recordsets per page if the client sets no limit
+	PageSize int
+
+	mu         sync.Mutex
+	lastID     int
+	tokens     map[string]bool
+	zones      map[string]*zone
+	recordSets map[string]map[string]*recordSet
+	deleted    map[string]bool
+	failures   []*failure
+	requests   []string
+}
+
+// New starts a fake cloud, which has to be closed after use
+func New() *Server {
+	s := &Server{
+		PageSize:   20,
+		tokens:     map[string]bool{},
+		zones:      map[string]*zone{},
+		recordSets: map[string]map[string]*recordSet{},
+		deleted:    map[string]bool{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /identity/", s.handleVersions)
+	mux.HandleFunc("POST /identity/v3/auth/tokens", s.handleTokens)
+	mux.HandleFunc("GET /dns/{$}", s.handleDNSVersions)
+	mux.HandleFunc("GET /dns/v2/zones", s.authenticated(s.handleListZones))
+	mux.HandleFunc("POST /dns/v2/zones", s.authenticated(s.handleCreateZone))
+	mux.HandleFunc("GET /dns/v2/zones/{zoneID}", s.authenticated(s.handleGetZone))
+	mux.HandleFunc("GET /dns/v2/zones/{zoneID}/nameservers", s.authenticated(s.handleNameservers))
+	mux.HandleFunc("GET /dns/v2/zones/{zoneID}/recordsets", s.authenticated(s.handleListRecordSets))
+	mux.HandleFunc("POST /dns/v2/zones/{zoneID}/recordsets", s.authenticated(s.handleCreateRecordSet))
+	mux.HandleFunc("GET /dns/v2/zones/{zoneID}/recordsets/{recordSetID}", s.authenticated(s.handleGetRecordSet))
+	mux.HandleFunc("PUT /dns/v2/zones/{zoneID}/recordsets/{recordSetID}", s.authenticated(s.handleUpdateRecordSet))
+	mux.HandleFunc("DELETE /dns/v2/zones/{zoneID}/recordsets/{recordSetID}", s.authenticated(s.handleDeleteRecordSet))
+	s.Server = httptest.NewServer(s.record(mux))
+	return s
+}
+
+// AuthURL returns the Keystone URL to put into clouds.yaml
+func (s *Server) AuthURL() string {
+	return s.URL + "/identity/v3"
+}
+
+// WriteCloudsYAML writes a clouds.yaml file for the cloud named CloudName to path
+func (s *Server) WriteCloudsYAML(path string) error {
+	content := fmt.Sprintf(`clouds:
+  %s:
+    auth:
+      auth_url: %s
+      username: %s
+      password: %s
+      project_name: %s
+      user_domain_name: Default
+      project_domain_name: Default
+    region_name: %s
+    interface: public
+`, CloudName, s.AuthURL(), Username, Password, ProjectName, Region)
+	return os.WriteFile(path, []byte(content), 0o600)
+}
+
+// AddZone adds an active zone including its SOA and NS recordsets and returns its ID
+func (s *Server) AddZone(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	z := s.createZone(name, "hostmaster@"+strings.TrimSuffix(name, "."), "", 3600)
+	s.settle()
+	return z.ID
+}
+
+// AddRecordSet adds an active recordset to a zone and returns its ID
+func (s *Server) AddRecordSet(zoneID, name, recordType string, ttl int, records ...string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rs := s.createRecordSet(s.zones[zoneID], name, recordType, ttl, "", records)
+	s.settle()
+	return rs.ID
+}
+
+// RecordSets returns the recordsets of a zone ordered by name and type
+func (s *Server) RecordSets(zoneID string) []RecordSet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []RecordSet
+	for _, rs := range s.recordSets[zoneID] {
+		if s.deleted[rs.ID] {
+			continue
+		}
+		result = append(result, RecordSet{
+			ID:          rs.ID,
+			Name:        rs.Name,
+			Type:        rs.Type,
+			TTL:         s.ttl(rs),
+			Records:     append([]string(nil), rs.Records...),
+			Description: rs.Description,
+			Status:      rs.Status,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].Type < result[j].Type
+	})
+	return result
+}
+
+// RevokeTokens invalidates all issued tokens, forcing clients to authenticate again
+func (s *Server) RevokeTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = map[string]bool{}
+}
+
+// Fail makes the next times requests with the given method and a path containing path fail with status
+func (s *Server) Fail(method, path string, status, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, &failure{method: method, path: path, status: status, remaining: times})
+}
+
+// Requests returns the method and URL of all requests received so far
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// record logs every request, settles pending changes and applies injected failures
+func (s *Server) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.RequestURI())
+		s.settle()
+		var status int
+		for _, f := range s.failures {
+			if f.remaining > 0 && f.method == r.Method && strings.Contains(r.URL.Path, f.path) {
+				f.remaining--
+				status = f.status
+				break
+			}
+		}
+		s.mu.Unlock()
+		if status != 0 {
+			writeError(w, status, "injected_failure", "injected failure")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticated rejects requests without a valid token
+func (s *Server) authenticated(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		valid := s.tokens[r.Header.Get("X-Auth-Token")]
+		s.mu.Unlock()
+		if !valid {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "The request you have made requires authentication.")
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		handler(w, r)
+	}
+}
+
+// settle activates pending zones and recordsets and removes deleted recordsets, must be called with mu held
+func (s *Server) settle() {
+	for _, z := range s.zones {
+		z.Status, z.Action = statusActive, actionNone
+	}
+	for zoneID, recordSets := range s.recordSets {
+		for id, rs := range recordSets {
+			if s.deleted[id] {
+				delete(s.recordSets[zoneID], id)
+				delete(s.deleted, id)
+				continue
+			}
+			rs.Status, rs.Action = statusActive, actionNone
+		}
+	}
+}
+
+func (s *Server) handleVersions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"versions": map[string]any{"values": []any{
+		map[string]any{"id": "v3.14", "status": "stable", "links": []any{map[string]any{"rel": "self", "href": s.AuthURL() + "/"}}},
+	}}})
+}
+
+func (s *Server) handleDNSVersions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"versions": []any{
+		map[string]any{"id": "v2.1", "status": "CURRENT", "links": []any{map[string]any{"rel": "self", "href": s.URL + "/dns/v2/"}}},
+	}})
+}
+
+func (s *Server) handleTokens(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Auth struct {
+			Identity struct {
+				Methods  []string `json:"methods"`
+				Password struct {
+					User struct {
+						Name     string `json:"name"`
+						Password string `json:"password"`
+					} `json:"user"`
+				} `json:"password"`
+			} `json:"identity"`
+		} `json:"auth"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	user := body.Auth.Identity.Password.User
+	if user.Name != Username || user.Password != Password {
+		writeError(w, http.StatusUnauthorized, "unauthorized", "The request you have made requires authentication.")
+		return
+	}
+
+	token := randomHex(16)
+	s.mu.Lock()
+	s.tokens[token] = true
+	s.mu.Unlock()
+
+	now := time.Now().UTC()
+	var endpoints []any
+	for _, iface := range []string{"public", "internal", "admin"} {
+		endpoints = append(endpoints, map[string]any{
+			"id": "dns-" + iface, "interface": iface, "region": Region, "region_id": Region, "url": s.URL + "/dns",
+		})
+	}
+	domain := map[string]any{"id": "default", "name": "Default"}
+	w.Header().Set("X-Subject-Token", token)
+	writeJSON(w, http.StatusCreated, map[string]any{"token": map[string]any{
+		"methods":    body.Auth.Identity.Methods,
+		"issued_at":  now.Format(time.RFC3339),
+		"expires_at": now.Add(time.Hour).Format(time.RFC3339),
+		"user":       map[string]any{"id": "user-id", "name": Username, "domain": domain},
+		"project":    map[string]any{"id": "project-id", "name": ProjectName, "domain": domain},
+		"catalog": []any{map[string]any{
+			"id": "dns", "type": "dns", "name": "designate", "endpoints": endpoints,
+		}},
+	}})
+}
+
+func (s *Server) handleListZones(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	var items []any
+	for _, id := range sortedKeys(s.zones) {
+		if name == "" || s.zones[id].Name == name {
+			items = append(items, s.zones[id])
+		}
+	}
+	s.writePage(w, r, "zones", items, func(item any) string { return item.(*zone).ID })
+}
+
+func (s *Server) handleCreateZone(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name        string `json:"name"`
+		Email       string `json:"email"`
+		Description string `json:"description"`
+		TTL         int    `json:"ttl"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_object", err.Error())
+		return
+	}
+	if !strings.HasSuffix(body.Name, ".") || body.Email == "" {
+		writeError(w, http.StatusBadRequest, "invalid_object", "Provided object does not match schema")
+		return
+	}
+	for _, z := range s.zones {
+		if z.Name == body.Name {
+			writeError(w, http.StatusConflict, "duplicate_zone", "Duplicate Zone")
+			return
+		}
+	}
+	if body.TTL == 0 {
+		body.TTL = 3600
+	}
+	writeJSON(w, http.StatusAccepted, s.createZone(body.Name, body.Email, body.Description, body.TTL))
+}
+
+func (s *Server) handleGetZone(w http.ResponseWriter, r *http.Request) {
+	z := s.zones[r.PathValue("zoneID")]
+	if z == nil {
+		writeError(w, http.StatusNotFound, "zone_not_found", "Could not find Zone")
+		return
+	}
+	writeJSON(w, http.StatusOK, z)
+}
+
+func (s *Server) handleNameservers(w http.ResponseWriter, r *http.Request) {
+	if s.zones[r.PathValue("zoneID")] == nil {
+		writeError(w, http.StatusNotFound, "zone_not_found", "Could not find Zone")
+		return
+	}
+	var result []any
+	for i, ns := range nameservers {
+		result = append(result, map[string]any{"hostname": ns, "priority": i + 1})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"nameservers": result})
+}
+
+func (s *Server) handleListRecordSets(w http.ResponseWriter, r *http.Request) {
+	zoneID := r.PathValue("zoneID")
+	if s.zones[zoneID] == nil {
+		writeError(w, http.StatusNotFound, "zone_not_found", "Could not find Zone")
+		return
+	}
+	query := r.URL.Query()
+	var items []any
+	for _, id := range sortedKeys(s.recordSets[zoneID]) {
+		rs := s.recordSets[zoneID][id]
+		if query.Get("name") != "" && rs.Name != query.Get("name") || query.Get("type") != "" && rs.Type != query.Get("type") {
+			continue
+		}
+		items = append(items, rs)
+	}
+	s.writePage(w, r, "recordsets", items, func(item any) string { return item.(*recordSet).ID })
+}
+
+func (s *Server) handleCreateRecordSet(w http.ResponseWriter, r *http.Request) {
+	z := s.zones[r.PathValue("zoneID")]
+	if z == nil {
+		writeError(w, http.StatusNotFound, "zone_not_found", "Could not find Zone")
+		return
+	}
+	var body struct {
+		Name        string   `json:"name"`
+		Type        string   `json:"type"`
+		TTL         int      `json:"ttl"`
+		Records     []string `json:"records"`
+		Description string   `json:"description"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_object", err.Error())
+		return
+	}
+	if body.Type == "" || len(body.Records) == 0 || !strings.HasSuffix(body.Name, ".") {
+		writeError(w, http.StatusBadRequest, "invalid_object", "Provided object does not match schema")
+		return
+	}
+	if body.Name != z.Name && !strings.HasSuffix(body.Name, "."+z.Name) {
+		writeError(w, http.StatusBadRequest, "invalid_recordset_location", "RecordSet belongs in a child zone")
+		return
+	}
+	for _, rs := range s.recordSets[z.ID] {
+		if rs.Name == body.Name && rs.Type == body.Type && !s.deleted[rs.ID] {
+			writeError(w, http.StatusConflict, "duplicate_recordset", "Duplicate RecordSet")
+			return
+		}
+	}
+	rs := s.createRecordSet(z, body.Name, body.Type, body.TTL, body.Description, body.Records)
+	writeJSON(w, http.StatusAccepted, rs)
+}
+
+func (s *Server) handleGetRecordSet(w http.ResponseWriter, r *http.Request) {
+	rs := s.findRecordSet(w, r)
+	if rs == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, rs)
+}
+
+func (s *Server) handleUpdateRecordSet(w http.ResponseWriter, r *http.Request) {
+	rs := s.findRecordSet(w, r)
+	if rs == nil {
+		return
+	}
+	var body struct {
+		TTL         *int     `json:"ttl"`
+		Records     []string `json:"records"`
+		Description *string  `json:"description"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_object", err.Error())
+		return
+	}
+	if body.TTL != nil {
+		rs.TTL = body.TTL
+		if *body.TTL == 0 {
+			rs.TTL = nil
+		}
+	}
+	if body.Records != nil {
+		rs.Records = body.Records
+	}
+	if body.Description != nil {
+		rs.Description = *body.Description
+	}
+	rs.Version++
+	rs.Status, rs.Action = statusPending, actionUpdate
+	rs.UpdatedAt = time.Now().UTC().Format(timeFormat)
+	s.bumpSerial(s.zones[rs.ZoneID])
+	writeJSON(w, http.StatusAccepted, rs)
+}
+
+func (s *Server) handleDeleteRecordSet(w http.ResponseWriter, r *http.Request) {
+	rs := s.findRecordSet(w, r)
+	if rs == nil {
+		return
+	}
+	s.deleted[rs.ID] = true
+	rs.Status, rs.Action = statusPending, actionDelete
+	s.bumpSerial(s.zones[rs.ZoneID])
+	writeJSON(w, http.StatusAccepted, rs)
+}
+
+// findRecordSet looks up the recordset of the request, writing an error if there is none
+func (s *Server) findRecordSet(w http.ResponseWriter, r *http.Request) *recordSet {
+	zoneID := r.PathValue("zoneID")
+	if s.zones[zoneID] == nil {
+		writeError(w, http.StatusNotFound, "zone_not_found", "Could not find Zone")
+		return nil
+	}
+	rs := s.recordSets[zoneID][r.PathValue("recordSetID")]
+	if rs == nil || s.deleted[rs.ID] {
+		writeError(w, http.StatusNotFound, "recordset_not_found", "Could not find RecordSet")
+		return nil
+	}
+	return rs
+}
+
+// createZone adds a pending zone with SOA and NS recordsets, must be called with mu held
+func (s *Server) createZone(name, email, description string, ttl int) *zone {
+	z := &zone{
+		ID:          s.nextID(),
+		ProjectID:   "project-id",
+		Name:        name,
+		Email:       email,
+		Description: description,
+		TTL:         ttl,
+		Serial:      int(time.Now().Unix()),
+		Status:      statusPending,
+		Action:      actionCreate,
+		Version:     1,
+		Type:        "PRIMARY",
+		CreatedAt:   time.Now().UTC().Format(timeFormat),
+	}
+	s.zones[z.ID] = z
+	s.recordSets[z.ID] = map[string]*recordSet{}
+	soa := fmt.Sprintf("%s %s. %d 3561 600 86400 3600", nameservers[0], strings.Replace(email, "@", ".", 1), z.Serial)
+	s.createRecordSet(z, name, "SOA", 0, "", []string{soa})
+	s.createRecordSet(z, name, "NS", 0, "", nameservers)
+	return z
+}
+
+// createRecordSet adds a pending recordset, must be called with mu held
+func (s *Server) createRecordSet(z *zone, name, recordType string, ttl int, description string, records []string) *recordSet {
+	rs := &recordSet{
+		ID:          s.nextID(),
+		ZoneID:      z.ID,
+		ProjectID:   z.ProjectID,
+		Name:        name,
+		ZoneName:    z.Name,
+		Type:        recordType,
+		Records:     append([]string(nil), records...),
+		Status:      statusPending,
+		Action:      actionCreate,
+		Description: description,
+		Version:     1,
+		CreatedAt:   time.Now().UTC().Format(timeFormat),
+	}
+	if ttl > 0 {
+		rs.TTL = &ttl
+	}
+	s.recordSets[z.ID][rs.ID] = rs
+	s.bumpSerial(z)
+	return rs
+}
+
+// bumpSerial increments the serial of a zone after a change, must be called with mu held
+func (s *Server) bumpSerial(z *zone) {
+	z.Serial++
+	z.Status, z.Action = statusPending, actionUpdate
+}
+
+// ttl returns the effective TTL of a recordset, must be called with mu held
+func (s *Server) ttl(rs *recordSet) int {
+	if rs.TTL != nil {
+		return *rs.TTL
+	}
+	return s.zones[rs.ZoneID].TTL
+}
+
+// nextID generates a UUID-like ID ordered by creation, must be called with mu held
+func (s *Server) nextID() string {
+	s.lastID++
+	return fmt.Sprintf("00000000-0000-4000-8000-%012d", s.lastID)
+}
+
+// writePage writes the items after the marker up to the limit, linking to the next page if there are more
+func (s *Server) writePage(w http.ResponseWriter, r *http.Request, key string, items []any, id func(any) string) {
+	query := r.URL.Query()
+	limit := s.PageSize
+	if l, err := strconv.Atoi(query.Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	start := 0
+	if marker := query.Get("marker"); marker != "" {
+		start = len(items)
+		for i, item := range items {
+			if id(item) == marker {
+				start = i + 1
+				break
+			}
+		}
+	}
+	end := min(start+limit, len(items))
+	page := append([]any{}, items[start:end]...)
+
+	links := map[string]string{"self": s.URL + r.URL.RequestURI()}
+	if end < len(items) {
+		query.Set("marker", id(items[end-1]))
+		query.Set("limit", strconv.Itoa(limit))
+		links["next"] = s.URL + r.URL.Path + "?" + query.Encode()
+	}
+	writeJSON(w, http.StatusOK, map[string]any{key: page, "links": links, "metadata": map[string]any{"total_count": len(items)}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, errorType, message string) {
+	writeJSON(w, status, map[string]any{"code": status, "type": errorType, "message": message, "request_id": "req-" + randomHex(8)})
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
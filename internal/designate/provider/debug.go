@@ -0,0 +1,145 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// DebugApply is the outcome of the last ApplyChanges call
+type DebugApply struct {
+	Timestamp time.Time     `json:"timestamp"`
+	Duration  float64       `json:"durationSeconds"`
+	Changes   *plan.Changes `json:"changes"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// DebugInfo exposes the provider's view of zones and records and the last ApplyChanges via HTTP.
+// A nil *DebugInfo records nothing.
+type DebugInfo struct {
+	mu        sync.Mutex
+	provider  *designateProvider
+	lastApply *DebugApply
+}
+
+// NewDebugInfo creates a DebugInfo, which has to be passed to the provider using WithDebugInfo
+func NewDebugInfo() *DebugInfo {
+	return &DebugInfo{}
+}
+
+// setProvider connects the provider whose view is exposed
+func (d *DebugInfo) setProvider(p *designateProvider) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.provider = p
+}
+
+// getProvider returns the connected provider, or nil if it has not been created yet
+func (d *DebugInfo) getProvider() *designateProvider {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.provider
+}
+
+// recordApply remembers the plan and result of an ApplyChanges call
+func (d *DebugInfo) recordApply(changes *plan.Changes, startTime time.Time, err error) {
+	if d == nil {
+		return
+	}
+	a := &DebugApply{
+		Timestamp: startTime,
+		Duration:  time.Since(startTime).Seconds(),
+		Changes:   changes,
+	}
+	if err != nil {
+		a.Error = err.Error()
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lastApply = a
+}
+
+// RegisterHandlers adds the /debug/zones, /debug/records and /debug/apply endpoints to mux
+func (d *DebugInfo) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/zones", d.serveZones)
+	mux.HandleFunc("/debug/records", d.serveRecords)
+	mux.HandleFunc("/debug/apply", d.serveApply)
+}
+
+// serveZones writes the managed zones as computed by getZones
+func (d *DebugInfo) serveZones(w http.ResponseWriter, r *http.Request) {
+	p := d.getProvider()
+	if p == nil {
+		http.Error(w, "provider not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	result, err := p.ManagedZones(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeDebugJSON(w, result)
+}
+
+// serveRecords writes the endpoints returned by Records including their labels, without counting as a sync
+func (d *DebugInfo) serveRecords(w http.ResponseWriter, r *http.Request) {
+	p := d.getProvider()
+	if p == nil {
+		http.Error(w, "provider not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	endpoints, err := p.records(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].DNSName != endpoints[j].DNSName {
+			return endpoints[i].DNSName < endpoints[j].DNSName
+		}
+		return endpoints[i].RecordType < endpoints[j].RecordType
+	})
+	writeDebugJSON(w, endpoints)
+}
+
+// serveApply writes the plan and result of the last ApplyChanges call
+func (d *DebugInfo) serveApply(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	lastApply := d.lastApply
+	d.mu.Unlock()
+	if lastApply == nil {
+		http.Error(w, "no changes applied yet", http.StatusNotFound)
+		return
+	}
+	writeDebugJSON(w, lastApply)
+}
+
+func writeDebugJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Errorf("Failed to write debug response: %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/dns/v2/recordsets"
+	log "github.com/sirupsen/logrus"
+)
+
+// record type of delegation recordsets
+const recordTypeNS = "NS"
+
+// findParentZones returns a child zone ID -> parent zone ID mapping for all managed zones that lie
+// below another managed zone. The parent is the closest enclosing zone.
+func findParentZones(managedZones map[string]string) map[string]string {
+	result := map[string]string{}
+	for childID, childName := range managedZones {
+		parentLength := 0
+		for parentID, parentName := range managedZones {
+			if len(parentName) <= parentLength || !strings.HasSuffix(childName, "."+parentName) {
+				continue
+			}
+			result[childID] = parentID
+			parentLength = len(parentName)
+		}
+	}
+	return result
+}
+
+// delegationState remembers the child zones whose delegation was synced, so that later batches only sync
+// the delegations of the zones they change
+type delegationState struct {
+	mu     sync.Mutex
+	synced map[string]bool
+}
+
+// needsSync tells whether the delegation of a child zone was not synced yet or is affected by the changes
+func (d *delegationState) needsSync(childID, parentID string, managedZones map[string]string, changes map[string]*recordSet) bool {
+	d.mu.Lock()
+	synced := d.synced[childID]
+	d.mu.Unlock()
+	if !synced {
+		return true
+	}
+	for _, rs := range changes {
+		if rs.zoneID == childID || rs.zoneID == parentID && rs.dnsName == managedZones[childID] {
+			return true
+		}
+	}
+	return false
+}
+
+// markSynced remembers that the delegation of a child zone is in sync
+func (d *delegationState) markSynced(childID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.synced[childID] = true
+}
+
+// syncDelegations makes sure every managed zone below another managed zone is delegated to by an NS recordset
+// in its parent zone that lists the nameservers of the child zone as reported by Designate. Delegations already
+// synced are only synced again if the changes touch the child zone or the NS recordset delegating to it.
+func (p designateProvider) syncDelegations(ctx context.Context, managedZones map[string]string, changes map[string]*recordSet) error {
+	parents := findParentZones(managedZones)
+	if len(parents) == 0 {
+		return nil
+	}
+
+	// existing NS recordsets per parent zone, indexed by name
+	existing := map[string]map[string]*recordsets.RecordSet{}
+	var errs []error
+	for childID, parentID := range parents {
+		if strings.HasPrefix(childID, dryRunZoneIDPrefix) || strings.HasPrefix(parentID, dryRunZoneIDPrefix) {
+			log.Debugf("Not delegating zone %s to zone %s that would only be created in dry-run mode", managedZones[childID], managedZones[parentID])
+			continue
+		}
+		if !p.delegation.needsSync(childID, parentID, managedZones, changes) {
+			continue
+		}
+		if existing[parentID] == nil {
+			nsRecordSets := map[string]*recordsets.RecordSet{}
+			err := p.client.ForEachRecordSet(ctx, parentID, func(recordSet *recordsets.RecordSet) error {
+				if recordSet.Type == recordTypeNS {
+					rs := *recordSet
+					nsRecordSets[canonicalizeDomainName(rs.Name)] = &rs
+				}
+				return nil
+			})
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to list recordsets of zone %s: %w", managedZones[parentID], err))
+				continue
+			}
+			existing[parentID] = nsRecordSets
+		}
+
+		synced, err := p.syncDelegation(ctx, childID, parentID, existing[parentID], managedZones)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to delegate zone %s: %w", managedZones[childID], err))
+			continue
+		}
+		if synced && !p.dryRun {
+			p.delegation.markSynced(childID)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// syncDelegation creates or updates the NS recordset for a single child zone in its parent zone. Tells whether
+// the delegation is in sync, which it is not while the child zone has no nameservers yet.
+func (p designateProvider) syncDelegation(ctx context.Context, childID, parentID string, nsRecordSets map[string]*recordsets.RecordSet, managedZones map[string]string) (bool, error) {
+	childName := managedZones[childID]
+	nameservers, err := p.client.ListNameservers(ctx, childID)
+	if err != nil {
+		return false, err
+	}
+	if len(nameservers) == 0 {
+		log.Debugf("Not delegating zone %s as it has no nameservers yet", childName)
+		return false, nil
+	}
+	for i, ns := range nameservers {
+		nameservers[i] = canonicalizeDomainName(ns)
+	}
+	sort.Strings(nameservers)
+
+	rs := &recordSet{
+		dnsName:    childName,
+		recordType: recordTypeNS,
+		zoneID:     parentID,
+		names:      map[string]bool{},
+	}
+	if current := nsRecordSets[childName]; current != nil {
+		records := make([]string, 0, len(current.Records))
+		for _, r := range current.Records {
+			records = append(records, canonicalizeDomainName(r))
+		}
+		sort.Strings(records)
+		if slices.Equal(records, nameservers) {
+			return true, nil
+		}
+		rs.recordSetID = current.ID
+		rs.ttl = current.TTL
+		rs.owner = ownerFromDescription(current.Description)
+		rs.protected = hasProtectedMarker(current.Description)
+		rs.originalRecords = current.Records
+		rs.originalTTL = current.TTL
+		for _, r := range records {
+			rs.names[r] = false
+		}
+	}
+	for _, ns := range nameservers {
+		rs.names[ns] = true
+	}
+
+	log.Infof("Syncing delegation of zone %s in parent zone %s to %v", childName, managedZones[parentID], nameservers)
+	_, err = p.upsertRecordSet(ctx, rs, managedZones)
+	return err == nil, err
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/external-dns/endpoint"
+
+	log "github.com/sirupsen/logrus"
+
+	"external-dns-openstack-webhook/internal/metrics"
+)
+
+// deletionThreshold limits how many recordsets a single ApplyChanges may delete
+type deletionThreshold struct {
+	// maximum number of recordsets deleted in one ApplyChanges, 0 disables the check
+	maxDeletions int
+	// maximum percentage of the recordsets of a zone deleted in one ApplyChanges, 0 disables the check
+	maxPercent float64
+	// apply deletions even if the threshold is exceeded, only logging and counting the violation
+	override bool
+}
+
+// checkDeletionThreshold returns an error if the deletions contained in recordSets exceed the configured threshold.
+// Deletions of protected recordsets or recordsets of other owners are not counted as they are never executed.
+func (p designateProvider) checkDeletionThreshold(recordSets map[string]*recordSet, existing []*endpoint.Endpoint) error {
+	t := p.deletionThreshold
+	if t.maxDeletions <= 0 && t.maxPercent <= 0 {
+		return nil
+	}
+
+	deletions := 0
+	zoneDeletions := map[string]int{}
+	for _, rs := range recordSets {
+		if !rs.isDeletion() || p.isProtected(rs) || !p.mayChangeRecordSet(rs.owner) {
+			continue
+		}
+		deletions++
+		zoneDeletions[rs.zoneID]++
+	}
+
+	var err error
+	if t.maxDeletions > 0 && deletions > t.maxDeletions {
+		err = fmt.Errorf("refusing to delete %d recordsets, which exceeds the deletion threshold of %d", deletions, t.maxDeletions)
+	}
+	if err == nil && t.maxPercent > 0 {
+		zoneSizes := map[string]int{}
+		for _, ep := range existing {
+			zoneSizes[ep.Labels[designateZoneID]]++
+		}
+		for zoneID, n := range zoneDeletions {
+			if zoneSizes[zoneID] == 0 {
+				continue
+			}
+			percent := float64(n) * 100 / float64(zoneSizes[zoneID])
+			if percent > t.maxPercent {
+				err = fmt.Errorf("refusing to delete %d of %d recordsets (%.1f%%) in zone %s, which exceeds the deletion threshold of %.1f%%",
+					n, zoneSizes[zoneID], percent, zoneID, t.maxPercent)
+				break
+			}
+		}
+	}
+	if err == nil {
+		return nil
+	}
+
+	metrics.DeletionThresholdExceededTotal.Inc()
+	if t.override {
+		log.Warnf("Deletion threshold exceeded, but applying deletions anyway as the override is set: %v", err)
+		return nil
+	}
+	log.Errorf("Deletion threshold exceeded, only applying creates and updates: %v", err)
+	return err
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/dns/v2/recordsets"
+	log "github.com/sirupsen/logrus"
+
+	"external-dns-openstack-webhook/internal/audit"
+	"external-dns-openstack-webhook/internal/events"
+	"external-dns-openstack-webhook/internal/metrics"
+)
+
+// kinds of drift, used as metric label
+const (
+	DriftModified  = "modified"
+	DriftDeleted   = "deleted"
+	DriftRecreated = "recreated"
+)
+
+// Drift is a recordset that was changed in Designate after ApplyChanges last wrote it
+type Drift struct {
+	Kind            string   `json:"kind"`
+	ZoneID          string   `json:"zoneId"`
+	RecordSetID     string   `json:"recordSetId,omitempty"`
+	Name            string   `json:"name"`
+	Type            string   `json:"type"`
+	ExpectedTTL     int      `json:"expectedTtl,omitempty"`
+	ExpectedRecords []string `json:"expectedRecords,omitempty"`
+	ActualTTL       int      `json:"actualTtl,omitempty"`
+	ActualRecords   []string `json:"actualRecords,omitempty"`
+	// resource label of the endpoint the recordset was last written for
+	Resource string `json:"resource,omitempty"`
+}
+
+// String describes the drift for logs and events
+func (d Drift) String() string {
+	describe := func(ttl int, records []string) string {
+		return fmt.Sprintf("ttl=%d %s", ttl, strings.Join(records, ","))
+	}
+	switch d.Kind {
+	case DriftDeleted:
+		return fmt.Sprintf("recordset %s/%s was deleted out-of-band, expected %s", d.Name, d.Type, describe(d.ExpectedTTL, d.ExpectedRecords))
+	case DriftRecreated:
+		return fmt.Sprintf("recordset %s/%s was recreated out-of-band after its deletion: %s", d.Name, d.Type, describe(d.ActualTTL, d.ActualRecords))
+	default:
+		return fmt.Sprintf("recordset %s/%s was modified out-of-band, expected %s, found %s", d.Name, d.Type,
+			describe(d.ExpectedTTL, d.ExpectedRecords), describe(d.ActualTTL, d.ActualRecords))
+	}
+}
+
+// DriftDetector compares the recordsets in Designate with the outcome of the last ApplyChanges
+type DriftDetector interface {
+	// DetectDrift returns the recordsets currently drifted and reports newly detected ones
+	DetectDrift(ctx context.Context) ([]Drift, error)
+}
+
+// expectedRecordSet is the state of a recordset as last written to Designate
+type expectedRecordSet struct {
+	zoneID      string
+	recordSetID string
+	name        string
+	recordType  string
+	ttl         int
+	records     []string
+	deleted     bool
+	resource    string
+	// description of the drift last reported, to report every drift only once
+	reported string
+}
+
+// driftState remembers the recordsets written by the provider. A nil *driftState remembers nothing.
+type driftState struct {
+	mu       sync.Mutex
+	expected map[string]*expectedRecordSet
+}
+
+func driftKey(zoneID, name, recordType string) string {
+	return zoneID + "/" + strings.ToLower(canonicalizeDomainName(name)) + "/" + recordType
+}
+
+// recordWrite remembers the state of a recordset after action was successfully applied to Designate
+func (d *driftState) recordWrite(rs *recordSet, action string, ttl int, records []string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.expected[driftKey(rs.zoneID, rs.dnsName, rs.recordType)] = &expectedRecordSet{
+		zoneID:      rs.zoneID,
+		recordSetID: rs.recordSetID,
+		name:        canonicalizeDomainName(rs.dnsName),
+		recordType:  rs.recordType,
+		ttl:         ttl,
+		records:     slices.Clone(records),
+		deleted:     action == audit.ActionDelete,
+		resource:    rs.resource,
+	}
+}
+
+// zoneIDs returns the zones holding expected recordsets
+func (d *driftState) zoneIDs() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var zoneIDs []string
+	for _, e := range d.expected {
+		zoneIDs = append(zoneIDs, e.zoneID)
+	}
+	sort.Strings(zoneIDs)
+	return slices.Compact(zoneIDs)
+}
+
+// DetectDrift lists the recordsets of all zones written to and compares them to their expected state.
+// Newly detected drift is logged, counted and emitted as event; the gauge reflects all current drift.
+func (p designateProvider) DetectDrift(ctx context.Context) ([]Drift, error) {
+	if p.drift == nil {
+		return nil, nil
+	}
+	actual := map[string]*recordsets.RecordSet{}
+	for _, zoneID := range p.drift.zoneIDs() {
+		err := p.client.ForEachRecordSet(ctx, zoneID, func(recordSet *recordsets.RecordSet) error {
+			actual[driftKey(zoneID, recordSet.Name, recordSet.Type)] = recordSet
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list recordsets of zone %s: %w", zoneID, err)
+		}
+	}
+
+	p.drift.mu.Lock()
+	defer p.drift.mu.Unlock()
+	var drifts []Drift
+	for key, e := range p.drift.expected {
+		drift := compareRecordSet(e, actual[key])
+		if drift == nil && e.deleted {
+			// the deletion is confirmed, forget the recordset so that the state does not grow with every name deleted
+			delete(p.drift.expected, key)
+			continue
+		}
+		if drift == nil {
+			e.reported = ""
+			continue
+		}
+		drifts = append(drifts, *drift)
+		description := drift.String()
+		if e.reported == description {
+			continue
+		}
+		e.reported = description
+		log.Warnf("Drift detected in zone %s: %s", e.zoneID, description)
+		metrics.DriftDetectedTotal.WithLabelValues(drift.Kind).Inc()
+		p.events.Eventf(e.resource, events.TypeWarning, "DNSDriftDetected", "%s", description)
+	}
+	metrics.DriftedRecordSets.Set(float64(len(drifts)))
+
+	sort.Slice(drifts, func(i, j int) bool {
+		if drifts[i].Name != drifts[j].Name {
+			return drifts[i].Name < drifts[j].Name
+		}
+		return drifts[i].Type < drifts[j].Type
+	})
+	return drifts, nil
+}
+
+// compareRecordSet returns the drift between the expected and the actual recordset, nil if there is none.
+// The TTL is only compared if one was written explicitly.
+func compareRecordSet(e *expectedRecordSet, actual *recordsets.RecordSet) *Drift {
+	drift := &Drift{
+		ZoneID:          e.zoneID,
+		RecordSetID:     e.recordSetID,
+		Name:            e.name,
+		Type:            e.recordType,
+		ExpectedTTL:     e.ttl,
+		ExpectedRecords: sortedRecords(e.records),
+		Resource:        e.resource,
+	}
+	if actual != nil {
+		drift.RecordSetID = actual.ID
+		drift.ActualTTL = actual.TTL
+		drift.ActualRecords = sortedRecords(actual.Records)
+	}
+	switch {
+	case e.deleted && actual != nil:
+		drift.Kind = DriftRecreated
+	case e.deleted:
+		return nil
+	case actual == nil:
+		drift.Kind = DriftDeleted
+	case !sameRecords(e.records, actual.Records) || e.ttl > 0 && e.ttl != actual.TTL:
+		drift.Kind = DriftModified
+	default:
+		return nil
+	}
+	return drift
+}
+
+func sortedRecords(records []string) []string {
+	records = slices.Clone(records)
+	sort.Strings(records)
+	return records
+}
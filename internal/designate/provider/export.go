@@ -0,0 +1,69 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/dns/v2/recordsets"
+
+	"external-dns-openstack-webhook/internal/zonefile"
+)
+
+// ZoneExporter is implemented by the designate provider to export the recordsets of its zones
+type ZoneExporter interface {
+	ZoneLister
+	// ZoneRecordSets returns all recordsets of a zone ordered by name and type, the SOA first
+	ZoneRecordSets(ctx context.Context, zoneID string) ([]zonefile.RecordSet, error)
+	// ExportZone writes all recordsets of a zone as RFC 1035 zone file to w
+	ExportZone(ctx context.Context, zone Zone, w io.Writer) error
+}
+
+// ZoneRecordSets returns all recordsets of the zone regardless of their type and owner
+func (p designateProvider) ZoneRecordSets(ctx context.Context, zoneID string) ([]zonefile.RecordSet, error) {
+	result := []zonefile.RecordSet{}
+	err := p.client.ForEachRecordSet(ctx, zoneID,
+		func(recordSet *recordsets.RecordSet) error {
+			if recordSet.Status == "DELETE" {
+				return nil
+			}
+			result = append(result, zonefile.RecordSet{
+				Name:    canonicalizeDomainName(recordSet.Name),
+				Type:    recordSet.Type,
+				TTL:     recordSet.TTL,
+				Records: recordSet.Records,
+			})
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	zonefile.Sort(result)
+	return result, nil
+}
+
+// ExportZone writes all recordsets of the zone as RFC 1035 zone file to w
+func (p designateProvider) ExportZone(ctx context.Context, zone Zone, w io.Writer) error {
+	recordSets, err := p.ZoneRecordSets(ctx, zone.ID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch recordsets of zone %s: %w", zone.Name, err)
+	}
+	return zonefile.Write(w, zone.Name, zone.TTL, recordSets)
+}
@@ -0,0 +1,183 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/dns/v2/recordsets"
+	log "github.com/sirupsen/logrus"
+
+	"external-dns-openstack-webhook/internal/audit"
+	"external-dns-openstack-webhook/internal/zonefile"
+)
+
+// ImportChange is a change to a recordset that restores the state of a zone file
+type ImportChange struct {
+	Action     string   `json:"action"`
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	TTL        int      `json:"ttl,omitempty"`
+	OldTTL     int      `json:"oldTTL,omitempty"`
+	OldRecords []string `json:"oldRecords,omitempty"`
+	NewRecords []string `json:"newRecords,omitempty"`
+	// set if the change was refused, e.g. because the recordset is protected or owned by somebody else
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// ZoneImporter is implemented by the designate provider to restore zones from zone files
+type ZoneImporter interface {
+	ZoneLister
+	// ImportZone changes the recordsets of the zone to the given ones and returns the changes made
+	ImportZone(ctx context.Context, zone Zone, recordSets []zonefile.RecordSet, prune bool) ([]ImportChange, error)
+}
+
+// ImportZone creates and updates the recordsets of the zone to match the given ones, only logging the changes in dry-run mode.
+// With prune set, recordsets missing from the given ones are deleted. Recordsets outside of the zone or the domain filter
+// as well as the SOA and NS recordsets at the zone apex, which are maintained by Designate, are left untouched.
+func (p designateProvider) ImportZone(ctx context.Context, zone Zone, recordSets []zonefile.RecordSet, prune bool) ([]ImportChange, error) {
+	zone.Name = canonicalizeDomainName(zone.Name)
+	importable := func(name, recordType string) bool {
+		if name == zone.Name && (recordType == "SOA" || recordType == "NS") {
+			return false
+		}
+		return (name == zone.Name || strings.HasSuffix(name, "."+zone.Name)) && p.domainFilter.Match(name)
+	}
+
+	current := map[string]*recordsets.RecordSet{}
+	err := p.client.ForEachRecordSet(ctx, zone.ID,
+		func(recordSet *recordsets.RecordSet) error {
+			name := canonicalizeDomainName(recordSet.Name)
+			if recordSet.Status != "DELETE" && importable(name, recordSet.Type) {
+				current[name+"/"+recordSet.Type] = recordSet
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []*recordSet
+	for _, desired := range recordSets {
+		name := canonicalizeDomainName(desired.Name)
+		if !importable(name, desired.Type) {
+			log.Debugf("Not importing %s/%s because it is outside of zone %s or the domain filter", name, desired.Type, zone.Name)
+			continue
+		}
+		rs := &recordSet{
+			dnsName:    name,
+			recordType: desired.Type,
+			zoneID:     zone.ID,
+			ttl:        desired.TTL,
+			names:      map[string]bool{},
+		}
+		for _, record := range desired.Records {
+			rs.names[record] = true
+		}
+		key := name + "/" + desired.Type
+		if existing := current[key]; existing != nil {
+			delete(current, key)
+			p.loadExistingRecordSet(rs, existing)
+			if sameRecords(existing.Records, desired.Records) && effectiveTTL(existing.TTL, zone) == effectiveTTL(desired.TTL, zone) {
+				continue
+			}
+		}
+		pending = append(pending, rs)
+	}
+	if prune {
+		for key, existing := range current {
+			rs := &recordSet{
+				dnsName:    canonicalizeDomainName(existing.Name),
+				recordType: existing.Type,
+				zoneID:     zone.ID,
+				names:      map[string]bool{},
+			}
+			p.loadExistingRecordSet(rs, existing)
+			pending = append(pending, rs)
+			delete(current, key)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		if pending[i].dnsName != pending[j].dnsName {
+			return pending[i].dnsName < pending[j].dnsName
+		}
+		return pending[i].recordType < pending[j].recordType
+	})
+
+	var changes []ImportChange
+	managedZones := map[string]string{zone.ID: zone.Name}
+	for _, rs := range pending {
+		change := ImportChange{
+			Action:     audit.ActionCreate,
+			Name:       rs.dnsName,
+			Type:       rs.recordType,
+			TTL:        rs.ttl,
+			OldTTL:     rs.originalTTL,
+			OldRecords: rs.originalRecords,
+			NewRecords: rs.records(),
+		}
+		sort.Strings(change.OldRecords)
+		sort.Strings(change.NewRecords)
+		switch {
+		case rs.isDeletion():
+			change.Action = audit.ActionDelete
+		case rs.recordSetID != "":
+			change.Action = audit.ActionUpdate
+		}
+
+		action, err2 := p.upsertRecordSet(ctx, rs, managedZones)
+		if err2 != nil {
+			if err == nil {
+				err = err2
+			}
+			continue
+		}
+		change.Skipped = action == ""
+		changes = append(changes, change)
+	}
+	return changes, err
+}
+
+// loadExistingRecordSet fills in the ID, original values, owner and protection of an existing recordset
+func (p designateProvider) loadExistingRecordSet(rs *recordSet, existing *recordsets.RecordSet) {
+	rs.recordSetID = existing.ID
+	rs.originalRecords = append([]string(nil), existing.Records...)
+	rs.originalTTL = existing.TTL
+	rs.owner = ownerFromDescription(existing.Description)
+	rs.protected = hasProtectedMarker(existing.Description)
+}
+
+// effectiveTTL resolves a TTL of 0 to the default TTL of the zone
+func effectiveTTL(ttl int, zone Zone) int {
+	if ttl == 0 {
+		return zone.TTL
+	}
+	return ttl
+}
+
+// sameRecords tells whether two lists hold the same records regardless of their order
+func sameRecords(a, b []string) bool {
+	a = slices.Clone(a)
+	b = slices.Clone(b)
+	sort.Strings(a)
+	sort.Strings(b)
+	return slices.Equal(slices.Compact(a), slices.Compact(b))
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"regexp"
+
+	"external-dns-openstack-webhook/internal/audit"
+	"external-dns-openstack-webhook/internal/events"
+	"external-dns-openstack-webhook/internal/notify"
+)
+
+// Option configures optional behaviour of the designate provider
+type Option func(*designateProvider)
+
+// WithOwnership stamps created recordsets with ownerID and restricts the provider to recordsets carrying it
+func WithOwnership(ownerID string, mode OwnershipMode) Option {
+	return func(p *designateProvider) {
+		p.ownerID = ownerID
+		p.ownershipMode = mode
+	}
+}
+
+// WithProtectedRecords protects recordsets whose names are listed or match one of the patterns from any change
+func WithProtectedRecords(names []string, patterns []*regexp.Regexp) Option {
+	return func(p *designateProvider) {
+		if p.protection.names == nil {
+			p.protection.names = map[string]bool{}
+		}
+		for _, name := range names {
+			p.protection.names[canonicalizeDomainName(name)] = true
+		}
+		p.protection.patterns = append(p.protection.patterns, patterns...)
+	}
+}
+
+// WithDeletionThreshold refuses deletions in ApplyChanges if more than maxDeletions recordsets or more than
+// maxPercent percent of the recordsets of a zone would be deleted. With override set, violations are only reported.
+func WithDeletionThreshold(maxDeletions int, maxPercent float64, override bool) Option {
+	return func(p *designateProvider) {
+		p.deletionThreshold = deletionThreshold{
+			maxDeletions: maxDeletions,
+			maxPercent:   maxPercent,
+			override:     override,
+		}
+	}
+}
+
+// WithAuditLogger records every change applied to Designate in the given audit log
+func WithAuditLogger(l *audit.Logger) Option {
+	return func(p *designateProvider) {
+		p.auditLogger = l
+	}
+}
+
+// WithTransactions reverts the already applied changes of an ApplyChanges call on a best-effort basis if one of them fails
+func WithTransactions() Option {
+	return func(p *designateProvider) {
+		p.transactional = true
+	}
+}
+
+// WithZoneCreation creates missing zones for hostnames below one of the parent domains, using the directly
+// subordinate label of the parent as zone name (e.g. team.example.com for www.team.example.com below example.com)
+func WithZoneCreation(parents []string, email string, ttl int, description string) Option {
+	return func(p *designateProvider) {
+		p.zoneCreation = zoneCreation{
+			email:       email,
+			ttl:         ttl,
+			description: description,
+		}
+		for _, parent := range parents {
+			p.zoneCreation.parents = append(p.zoneCreation.parents, canonicalizeDomainName(parent))
+		}
+	}
+}
+
+// WithDelegation keeps NS recordsets in parent zones in sync with the nameservers of managed child zones
+func WithDelegation() Option {
+	return func(p *designateProvider) {
+		p.delegation = &delegationState{synced: map[string]bool{}}
+	}
+}
+
+// WithStrictZoneMatching makes ApplyChanges fail for records whose name matches no managed zone instead of skipping them
+func WithStrictZoneMatching() Option {
+	return func(p *designateProvider) {
+		p.strictZoneMatching = true
+	}
+}
+
+// WithUnmatchedRecords tracks the records currently skipped for lack of a matching zone in u
+func WithUnmatchedRecords(u *UnmatchedRecords) Option {
+	return func(p *designateProvider) {
+		p.unmatchedRecords = u
+	}
+}
+
+// WithDebugInfo makes the provider's view of zones and records and its last ApplyChanges available through d
+func WithDebugInfo(d *DebugInfo) Option {
+	return func(p *designateProvider) {
+		p.debugInfo = d
+		d.setProvider(p)
+	}
+}
+
+// WithSyncStatus tracks the outcome of the Records and ApplyChanges calls in s. It is only meant for the provider
+// serving external-dns, as every call counts as a sync; inspection tools use the unexported records instead.
+func WithSyncStatus(s *SyncStatus) Option {
+	return func(p *designateProvider) {
+		p.syncStatus = s
+	}
+}
+
+// WithDriftDetection remembers the recordsets written by ApplyChanges so that DetectDrift can find out-of-band changes
+func WithDriftDetection() Option {
+	return func(p *designateProvider) {
+		p.drift = &driftState{expected: map[string]*expectedRecordSet{}}
+	}
+}
+
+// WithEvents emits Kubernetes Events through r
+func WithEvents(r *events.Recorder) Option {
+	return func(p *designateProvider) {
+		p.events = r
+	}
+}
+
+// WithNotifier sends a summary of the outcome of every ApplyChanges to n
+func WithNotifier(n *notify.Notifier) Option {
+	return func(p *designateProvider) {
+		p.notifier = n
+	}
+}
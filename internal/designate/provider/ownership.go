@@ -0,0 +1,182 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/dns/v2/recordsets"
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/external-dns/endpoint"
+
+	"external-dns-openstack-webhook/internal/audit"
+)
+
+// OwnershipMode controls how recordsets owned by somebody else are treated
+type OwnershipMode string
+
+const (
+	// OwnershipFilter hides recordsets of other owners from Records, so they are neither seen nor changed
+	OwnershipFilter OwnershipMode = "filter"
+	// OwnershipGuard returns all recordsets from Records, but refuses to change the ones of other owners
+	OwnershipGuard OwnershipMode = "guard"
+
+	// prefix of the token in the recordset description that carries the owner ID
+	ownerDescriptionPrefix = "external-dns-owner="
+)
+
+// ParseOwnershipMode converts a command line value into an OwnershipMode
+func ParseOwnershipMode(mode string) (OwnershipMode, error) {
+	switch m := OwnershipMode(strings.ToLower(mode)); m {
+	case OwnershipFilter, OwnershipGuard:
+		return m, nil
+	default:
+		return "", fmt.Errorf("invalid ownership mode %q: must be %q or %q", mode, OwnershipFilter, OwnershipGuard)
+	}
+}
+
+// descriptionTokens splits a recordset description into its whitespace or semicolon separated tokens
+func descriptionTokens(description string) []string {
+	return strings.FieldsFunc(description, func(r rune) bool {
+		return r == ';' || r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+}
+
+// ownerFromDescription returns the owner ID stamped into a recordset description, or "" if there is none
+func ownerFromDescription(description string) string {
+	for _, token := range descriptionTokens(description) {
+		if owner, ok := strings.CutPrefix(token, ownerDescriptionPrefix); ok {
+			return owner
+		}
+	}
+	return ""
+}
+
+// ownerDescription returns the recordset description that marks a recordset as owned by ownerID
+func ownerDescription(ownerID string) string {
+	if ownerID == "" {
+		return ""
+	}
+	return ownerDescriptionPrefix + ownerID
+}
+
+// ownershipEnabled tells whether the provider restricts itself to the recordsets of its owner ID
+func (p designateProvider) ownershipEnabled() bool {
+	return p.ownerID != ""
+}
+
+// hidesRecordSet tells whether Records should leave out a recordset with the given owner
+func (p designateProvider) hidesRecordSet(owner string) bool {
+	return p.ownershipEnabled() && p.ownershipMode != OwnershipGuard && owner != p.ownerID
+}
+
+// mayChangeRecordSet tells whether an existing recordset with the given owner may be updated or deleted
+func (p designateProvider) mayChangeRecordSet(owner string) bool {
+	return !p.ownershipEnabled() || owner == p.ownerID
+}
+
+// OwnerClaimer is implemented by the designate provider to take over existing recordsets
+type OwnerClaimer interface {
+	// ClaimRecordSets stamps the owner ID into the recordsets of the endpoints and returns the number of recordsets changed
+	ClaimRecordSets(ctx context.Context, endpoints []*endpoint.Endpoint) (int, error)
+}
+
+// ClaimRecordSets adds the owner ID to the description of the recordsets of endpoints returned by Records that don't carry
+// an owner ID yet. Recordsets of other owners and protected recordsets are left untouched.
+func (p designateProvider) ClaimRecordSets(ctx context.Context, endpoints []*endpoint.Endpoint) (int, error) {
+	if !p.ownershipEnabled() {
+		return 0, fmt.Errorf("claiming recordsets requires an owner ID")
+	}
+	managedZones, err := p.getZones(ctx)
+	if err != nil {
+		return 0, err
+	}
+	claims := map[string]map[string]bool{}
+	for _, ep := range endpoints {
+		zoneID := ep.Labels[designateZoneID]
+		if claims[zoneID] == nil {
+			claims[zoneID] = map[string]bool{}
+		}
+		claims[zoneID][ep.Labels[designateRecordSetID]] = true
+	}
+
+	claimed := 0
+	for zoneID, recordSetIDs := range claims {
+		var toClaim []*recordsets.RecordSet
+		err := p.client.ForEachRecordSet(ctx, zoneID,
+			func(recordSet *recordsets.RecordSet) error {
+				if recordSetIDs[recordSet.ID] {
+					toClaim = append(toClaim, recordSet)
+				}
+				return nil
+			},
+		)
+		if err != nil {
+			return claimed, err
+		}
+		for _, recordSet := range toClaim {
+			switch owner := ownerFromDescription(recordSet.Description); {
+			case owner == p.ownerID:
+				continue
+			case owner != "":
+				log.Warnf("Not claiming %s/%s because it is owned by %q", recordSet.Name, recordSet.Type, owner)
+				continue
+			case hasProtectedMarker(recordSet.Description) || p.protection.matches(canonicalizeDomainName(recordSet.Name)):
+				log.Warnf("Not claiming %s/%s because the recordset is protected", recordSet.Name, recordSet.Type)
+				continue
+			}
+			if err := p.claimRecordSet(ctx, zoneID, recordSet, managedZones); err != nil {
+				return claimed, err
+			}
+			claimed++
+		}
+	}
+	return claimed, nil
+}
+
+// claimRecordSet appends the owner ID to the description of the recordset
+func (p designateProvider) claimRecordSet(ctx context.Context, zoneID string, existing *recordsets.RecordSet, managedZones map[string]string) error {
+	description := strings.TrimSpace(existing.Description + " " + ownerDescription(p.ownerID))
+	log.Infof("Claiming records: %s/%s", existing.Name, existing.Type)
+
+	opts := recordsets.UpdateOpts{
+		Description: &description,
+		Records:     existing.Records,
+	}
+	if existing.TTL > 0 {
+		opts.TTL = &existing.TTL
+	}
+	startTime := time.Now()
+	var err error
+	if !p.dryRun {
+		err = p.client.UpdateRecordSet(ctx, zoneID, existing.ID, opts)
+	}
+	rs := &recordSet{
+		dnsName:         canonicalizeDomainName(existing.Name),
+		recordType:      existing.Type,
+		zoneID:          zoneID,
+		recordSetID:     existing.ID,
+		ttl:             existing.TTL,
+		originalRecords: existing.Records,
+		originalTTL:     existing.TTL,
+	}
+	p.auditChange(rs, managedZones, audit.ActionUpdate, existing.Records, time.Since(startTime), err)
+	return err
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"regexp"
+	"slices"
+)
+
+// token in the recordset description that protects a recordset from any change by the webhook
+const protectedDescriptionMarker = "external-dns-protected"
+
+// recordProtection holds the names and patterns of recordsets that must never be changed
+type recordProtection struct {
+	names    map[string]bool
+	patterns []*regexp.Regexp
+}
+
+// hasProtectedMarker tells whether a recordset description carries the protection marker
+func hasProtectedMarker(description string) bool {
+	return slices.Contains(descriptionTokens(description), protectedDescriptionMarker)
+}
+
+// matches tells whether the given FQDN is protected by name or pattern
+func (rp recordProtection) matches(dnsName string) bool {
+	if rp.names[dnsName] {
+		return true
+	}
+	for _, re := range rp.patterns {
+		if re.MatchString(dnsName) {
+			return true
+		}
+	}
+	return false
+}
+
+// isProtected tells whether the recordset must be left untouched
+func (p designateProvider) isProtected(rs *recordSet) bool {
+	return rs.protected || p.protection.matches(rs.dnsName)
+}
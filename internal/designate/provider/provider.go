@@ -20,7 +20,9 @@ package provider
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/gophercloud/gophercloud/v2/openstack/dns/v2/recordsets"
 	"github.com/gophercloud/gophercloud/v2/openstack/dns/v2/zones"
@@ -30,7 +32,11 @@ import (
 	"sigs.k8s.io/external-dns/plan"
 	"sigs.k8s.io/external-dns/provider"
 
+	"external-dns-openstack-webhook/internal/audit"
 	"external-dns-openstack-webhook/internal/designate/client"
+	"external-dns-openstack-webhook/internal/events"
+	"external-dns-openstack-webhook/internal/metrics"
+	"external-dns-openstack-webhook/internal/notify"
 )
 
 const (
@@ -43,6 +49,20 @@ const (
 	// changed where there are several targets per domain and only some of them changed.
 	// Values are joined by zero-byte to in order to get a single string
 	designateOriginalRecords = "designate-original-records"
+
+	// Owner ID found in the description of the RecordSet
+	designateOwnerID = "designate-owner-id"
+	// Set if the description of the RecordSet carries the protection marker
+	designateProtected = "designate-protected"
+	// Description of the RecordSet, restored when a rollback recreates it
+	designateDescription = "designate-description"
+)
+
+// labels of the endpoints returned by Records that are of interest for inspection tools
+const (
+	RecordSetIDLabel = designateRecordSetID
+	ZoneIDLabel      = designateZoneID
+	OwnerIDLabel     = designateOwnerID
 )
 
 // designate provider type
@@ -53,19 +73,60 @@ type designateProvider struct {
 	// only consider hosted zones managing domains ending in this suffix
 	domainFilter endpoint.DomainFilter
 	dryRun       bool
+
+	// owner ID stamped into recordset descriptions, ownership tracking is disabled if empty
+	ownerID       string
+	ownershipMode OwnershipMode
+
+	// recordsets that are never changed
+	protection recordProtection
+
+	// limit for deletions in a single ApplyChanges
+	deletionThreshold deletionThreshold
+
+	// receives one entry per change applied to Designate, may be nil
+	auditLogger *audit.Logger
+
+	// revert the already applied changes of an ApplyChanges if one of them fails
+	transactional bool
+
+	// create missing zones below configured parent domains
+	zoneCreation zoneCreation
+
+	// keeps NS recordsets delegating to child zones in their parent zones in sync, may be nil
+	delegation *delegationState
+
+	// fail records without matching zone instead of skipping them
+	strictZoneMatching bool
+	// records currently skipped for lack of a matching zone, may be nil
+	unmatchedRecords *UnmatchedRecords
+	// remembers the last ApplyChanges for the debug endpoints, may be nil
+	debugInfo *DebugInfo
+	// outcome of the Records and ApplyChanges calls, may be nil
+	syncStatus *SyncStatus
+	// recordsets as last written, compared to Designate by DetectDrift, may be nil
+	drift *driftState
+	// emits Kubernetes Events, may be nil
+	events *events.Recorder
+	// receives a summary of every ApplyChanges, may be nil
+	notifier *notify.Notifier
 }
 
 // NewDesignateProvider is a factory function for OpenStack designate providers
-func NewDesignateProvider(domainFilter endpoint.DomainFilter, dryRun bool) (provider.Provider, error) {
-	client, err := client.NewDesignateClient()
+func NewDesignateProvider(domainFilter endpoint.DomainFilter, dryRun bool, clientConfig client.Config, opts ...Option) (provider.Provider, error) {
+	client, err := client.NewDesignateClient(clientConfig)
 	if err != nil {
 		return nil, err
 	}
-	return &designateProvider{
+	p := &designateProvider{
 		client:       client,
 		domainFilter: domainFilter,
 		dryRun:       dryRun,
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p, nil
 }
 
 // converts domain names to FQDN
@@ -88,28 +149,60 @@ func canonicalizeDomainName(d string) string {
 	return strings.ToLower(d)
 }
 
-// returns ZoneID -> ZoneName mapping for zones that are managed by the Designate and match domain filter
-func (p designateProvider) getZones(ctx context.Context) (map[string]string, error) {
-	result := map[string]string{}
-
-	err := p.client.ForEachZone(ctx, p.domainFilter.Filters,
+// calls handler for every zone that is managed by the Designate and matches domain filter
+func (p designateProvider) forEachManagedZone(ctx context.Context, handler func(zone *zones.Zone)) error {
+	return p.client.ForEachZone(ctx, p.domainFilter.Filters,
 		func(zone *zones.Zone) error {
 			if zone.Type != "" && strings.ToUpper(zone.Type) != "PRIMARY" || zone.Status == "DELETE" {
 				return nil
 			}
-
-			zoneName := canonicalizeDomainName(zone.Name)
-			if !p.domainFilter.Match(zoneName) {
+			if !p.domainFilter.Match(canonicalizeDomainName(zone.Name)) {
 				return nil
 			}
-			result[zone.ID] = zoneName
+			handler(zone)
 			return nil
 		},
 	)
+}
 
+// returns ZoneID -> ZoneName mapping for zones that are managed by the Designate and match domain filter
+func (p designateProvider) getZones(ctx context.Context) (map[string]string, error) {
+	result := map[string]string{}
+	err := p.forEachManagedZone(ctx, func(zone *zones.Zone) {
+		result[zone.ID] = canonicalizeDomainName(zone.Name)
+	})
 	return result, err
 }
 
+// Zone is a zone managed by the provider
+type Zone struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// default TTL of the recordsets of the zone
+	TTL int `json:"ttl,omitempty"`
+}
+
+// ZoneLister is implemented by the designate provider to list the zones it manages
+type ZoneLister interface {
+	// ManagedZones returns the managed zones ordered by name
+	ManagedZones(ctx context.Context) ([]Zone, error)
+}
+
+// ManagedZones returns the zones that are managed by the Designate and match the domain filter, ordered by name
+func (p designateProvider) ManagedZones(ctx context.Context) ([]Zone, error) {
+	result := []Zone{}
+	err := p.forEachManagedZone(ctx, func(zone *zones.Zone) {
+		result = append(result, Zone{ID: zone.ID, Name: canonicalizeDomainName(zone.Name), TTL: zone.TTL})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
 // finds best suitable DNS zone for the hostname
 func getHostZoneID(hostname string, managedZones map[string]string) string {
 	longestZoneLength := 0
@@ -131,22 +224,44 @@ func getHostZoneID(hostname string, managedZones map[string]string) string {
 
 // Records returns the list of records.
 func (p designateProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
+	endpoints, err := p.records(ctx)
+	p.syncStatus.record(operationRecords, err)
+	return endpoints, err
+}
+
+// records fetches the records of all managed zones
+func (p designateProvider) records(ctx context.Context) ([]*endpoint.Endpoint, error) {
 	var result []*endpoint.Endpoint
 	managedZones, err := p.getZones(ctx)
 	if err != nil {
 		return nil, err
 	}
-	for zoneID := range managedZones {
+	recordSetCounts := map[[2]string]int{}
+	for zoneID, zoneName := range managedZones {
 		err = p.client.ForEachRecordSet(ctx, zoneID,
 			func(recordSet *recordsets.RecordSet) error {
+				recordSetCounts[[2]string{zoneName, recordSet.Type}]++
 				if recordSet.Type != endpoint.RecordTypeA && recordSet.Type != endpoint.RecordTypeTXT && recordSet.Type != endpoint.RecordTypeCNAME {
 					return nil
 				}
+				owner := ownerFromDescription(recordSet.Description)
+				if p.hidesRecordSet(owner) {
+					return nil
+				}
 
 				ep := endpoint.NewEndpointWithTTL(recordSet.Name, recordSet.Type, endpoint.TTL(recordSet.TTL), recordSet.Records...)
 				ep.Labels[designateRecordSetID] = recordSet.ID
 				ep.Labels[designateZoneID] = recordSet.ZoneID
 				ep.Labels[designateOriginalRecords] = strings.Join(recordSet.Records, "\000")
+				if owner != "" {
+					ep.Labels[designateOwnerID] = owner
+				}
+				if hasProtectedMarker(recordSet.Description) {
+					ep.Labels[designateProtected] = "true"
+				}
+				if recordSet.Description != "" {
+					ep.Labels[designateDescription] = recordSet.Description
+				}
 				result = append(result, ep)
 
 				return nil
@@ -157,6 +272,11 @@ func (p designateProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, e
 		}
 	}
 
+	metrics.ManagedZones.Set(float64(len(managedZones)))
+	metrics.RecordSets.Reset()
+	for key, count := range recordSetCounts {
+		metrics.RecordSets.WithLabelValues(key[0], key[1]).Set(float64(count))
+	}
 	return result, nil
 }
 
@@ -168,6 +288,34 @@ type recordSet struct {
 	recordSetID string
 	ttl         int
 	names       map[string]bool
+
+	// records, TTL and description of the existing recordset before the change
+	originalRecords     []string
+	originalTTL         int
+	originalDescription string
+
+	// owner ID of the existing recordset as currently found in Designate
+	owner string
+	// whether the existing recordset carries the protection marker
+	protected bool
+	// resource label of the endpoints, naming the Kubernetes object they originate from
+	resource string
+}
+
+// returns the records the recordset should hold after the change
+func (rs *recordSet) records() []string {
+	var records []string
+	for rec, v := range rs.names {
+		if v {
+			records = append(records, rec)
+		}
+	}
+	return records
+}
+
+// tells whether applying the change deletes the existing recordset
+func (rs *recordSet) isDeletion() bool {
+	return rs.recordSetID != "" && len(rs.records()) == 0
 }
 
 // adds endpoint into recordset aggregation, loading original values from endpoint labels first
@@ -191,9 +339,13 @@ func addEndpoint(ep *endpoint.Endpoint, recordSets map[string]*recordSet, oldEnd
 		rs.recordSetID = ep.Labels[designateRecordSetID]
 	}
 	rs.ttl = int(ep.RecordTTL)
-	for _, rec := range strings.Split(ep.Labels[designateOriginalRecords], "\000") {
-		if _, ok := rs.names[rec]; !ok && rec != "" {
+	if resource := ep.Labels[endpoint.ResourceLabelKey]; resource != "" {
+		rs.resource = resource
+	}
+	for _, rec := range splitRecords(ep.Labels[designateOriginalRecords]) {
+		if _, ok := rs.names[rec]; !ok {
 			rs.names[rec] = true
+			rs.originalRecords = append(rs.originalRecords, rec)
 		}
 	}
 	targets := ep.Targets
@@ -206,6 +358,14 @@ func addEndpoint(ep *endpoint.Endpoint, recordSets map[string]*recordSet, oldEnd
 	recordSets[key] = rs
 }
 
+// splitRecords returns the records joined into the designateOriginalRecords label, nil if there are none
+func splitRecords(label string) []string {
+	if label == "" {
+		return nil
+	}
+	return strings.Split(label, "\000")
+}
+
 // addDesignateIDLabelsFromExistingEndpoints adds the labels identified by the constants designateZoneID and designateRecordSetID
 // to an Endpoint. Therefore, it searches all given existing endpoints for an endpoint with the same record type and record
 // value. If the given Endpoint already has the labels set, they are left untouched. This fixes an issue with the
@@ -218,6 +378,10 @@ func addDesignateIDLabelsFromExistingEndpoints(existingEndpoints []*endpoint.End
 	}
 	for _, oep := range existingEndpoints {
 		if ep.RecordType == oep.RecordType && ep.DNSName == oep.DNSName {
+			// endpoints decoded from the webhook API lack labels if external-dns sent none
+			if ep.Labels == nil {
+				ep.Labels = endpoint.NewLabels()
+			}
 			if !hasZoneIDLabel {
 				ep.Labels[designateZoneID] = oep.Labels[designateZoneID]
 			}
@@ -229,86 +393,250 @@ func addDesignateIDLabelsFromExistingEndpoints(existingEndpoints []*endpoint.End
 	}
 }
 
+// ChangeSummarizer is implemented by the designate provider to report the recordsets changed by ApplyChanges
+type ChangeSummarizer interface {
+	// ApplyChangesWithSummary applies changes like ApplyChanges and returns the recordsets written, or the ones
+	// that would be written in dry-run mode
+	ApplyChangesWithSummary(ctx context.Context, changes *plan.Changes) (*notify.Summary, error)
+}
+
 // ApplyChanges applies a given set of changes in a given zone.
 func (p designateProvider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
+	_, err := p.ApplyChangesWithSummary(ctx, changes)
+	return err
+}
+
+// ApplyChangesWithSummary applies changes and returns the outcome per recordset
+func (p designateProvider) ApplyChangesWithSummary(ctx context.Context, changes *plan.Changes) (*notify.Summary, error) {
+	startTime := time.Now()
+	summary := &notify.Summary{Timestamp: startTime}
+	err := p.applyChanges(ctx, changes, summary)
+	p.debugInfo.recordApply(changes, startTime, err)
+	p.syncStatus.record(operationApplyChanges, err)
+	if !p.dryRun {
+		if err != nil {
+			summary.Error = err.Error()
+		}
+		p.notifier.Notify(summary)
+	}
+	return summary, err
+}
+
+// applyChanges aggregates the changes into recordsets and applies them, adding their outcome to summary
+func (p designateProvider) applyChanges(ctx context.Context, changes *plan.Changes, summary *notify.Summary) error {
 	managedZones, err := p.getZones(ctx)
 	if err != nil {
 		return err
 	}
 
-	endpoints, err := p.Records(ctx)
+	endpoints, err := p.records(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to fetch active records: %w", err)
 	}
 
+	// targets are removed before they are added, so a target both deleted and created stays
 	recordSets := map[string]*recordSet{}
-	for _, ep := range changes.Create {
-		addEndpoint(ep, recordSets, endpoints, false)
-	}
 	for _, ep := range changes.UpdateOld {
 		addEndpoint(ep, recordSets, endpoints, true)
 	}
+	for _, ep := range changes.Delete {
+		addEndpoint(ep, recordSets, endpoints, true)
+	}
+	for _, ep := range changes.Create {
+		addEndpoint(ep, recordSets, endpoints, false)
+	}
 	for _, ep := range changes.UpdateNew {
 		addEndpoint(ep, recordSets, endpoints, false)
 	}
-	for _, ep := range changes.Delete {
-		addEndpoint(ep, recordSets, endpoints, true)
+
+	existing := map[string]*endpoint.Endpoint{}
+	for _, ep := range endpoints {
+		existing[ep.Labels[designateRecordSetID]] = ep
+	}
+
+	for _, rs := range recordSets {
+		if ep := existing[rs.recordSetID]; ep != nil && rs.recordSetID != "" {
+			rs.owner = ep.Labels[designateOwnerID]
+			rs.protected = ep.Labels[designateProtected] != ""
+			rs.originalRecords = splitRecords(ep.Labels[designateOriginalRecords])
+			rs.originalTTL = int(ep.RecordTTL)
+			rs.originalDescription = ep.Labels[designateDescription]
+		}
 	}
 
+	thresholdErr := p.checkDeletionThreshold(recordSets, endpoints)
+
+	var applied []appliedChange
 	for _, rs := range recordSets {
-		if err2 := p.upsertRecordSet(ctx, rs, managedZones); err == nil {
+		if thresholdErr != nil && rs.isDeletion() {
+			log.Warnf("Not deleting records for %s/%s because the deletion threshold was exceeded", rs.dnsName, rs.recordType)
+			skipRecord(rs, skipReasonDeletionThreshold)
+			continue
+		}
+		action, err2 := p.upsertRecordSet(ctx, rs, managedZones)
+		if action != "" {
+			summary.Add(action, rs.dnsName, rs.recordType, rs.records(), err2)
+		}
+		if err2 != nil {
+			if err == nil {
+				err = err2
+			}
+			if p.transactional {
+				break
+			}
+			continue
+		}
+		if action != "" {
+			applied = append(applied, appliedChange{rs: rs, action: action})
+		}
+	}
+	if err != nil && p.transactional && !p.dryRun {
+		return p.rollback(ctx, applied, managedZones, summary, err)
+	}
+	if err == nil {
+		err = thresholdErr
+	}
+	if p.delegation != nil {
+		if err2 := p.syncDelegations(ctx, managedZones, recordSets); err == nil {
 			err = err2
 		}
 	}
 	return err
 }
 
-// apply recordset changes by inserting/updating/deleting recordsets
-func (p designateProvider) upsertRecordSet(ctx context.Context, rs *recordSet, managedZones map[string]string) error {
+// apply recordset changes by inserting/updating/deleting recordsets. Returns the audit action performed,
+// or "" if the recordset was left untouched.
+func (p designateProvider) upsertRecordSet(ctx context.Context, rs *recordSet, managedZones map[string]string) (string, error) {
 	if rs.zoneID == "" {
 		rs.zoneID = getHostZoneID(rs.dnsName, managedZones)
+		if rs.zoneID == "" && len(p.zoneCreation.parents) > 0 && len(rs.records()) > 0 {
+			zoneID, err := p.createZoneForHostname(ctx, rs.dnsName, managedZones)
+			if err != nil {
+				return "", err
+			}
+			rs.zoneID = zoneID
+		}
 		if rs.zoneID == "" {
+			skipRecord(rs, skipReasonNoZone)
+			p.unmatchedRecords.add(rs.dnsName, rs.recordType)
+			if p.strictZoneMatching {
+				return "", fmt.Errorf("no hosted zone matching record DNS Name %s was detected", rs.dnsName)
+			}
 			log.Debugf("Skipping record %s because no hosted zone matching record DNS Name was detected", rs.dnsName)
-			return nil
-		}
-	}
-	var records []string
-	for rec, v := range rs.names {
-		if v {
-			records = append(records, rec)
+			return "", nil
 		}
 	}
+	p.unmatchedRecords.remove(rs.dnsName, rs.recordType)
+	records := rs.records()
 	if rs.recordSetID == "" && records == nil {
-		return nil
+		return "", nil
+	}
+	if p.isProtected(rs) {
+		log.Warnf("Refusing to change records for %s/%s because the recordset is protected", rs.dnsName, rs.recordType)
+		metrics.ProtectedRecordChangesTotal.Inc()
+		skipRecord(rs, skipReasonProtected)
+		return "", nil
+	}
+	if rs.recordSetID != "" && !p.mayChangeRecordSet(rs.owner) {
+		log.Warnf("Refusing to change records for %s/%s because the recordset is not owned by %q", rs.dnsName, rs.recordType, p.ownerID)
+		skipRecord(rs, skipReasonNotOwned)
+		return "", nil
 	}
+
+	startTime := time.Now()
+	var action string
+	var err error
 	if rs.recordSetID == "" {
+		action = audit.ActionCreate
 		opts := recordsets.CreateOpts{
-			Name:    rs.dnsName,
-			Type:    rs.recordType,
-			Records: records,
-			TTL:     rs.ttl,
+			Name:        rs.dnsName,
+			Type:        rs.recordType,
+			Records:     records,
+			TTL:         rs.ttl,
+			Description: ownerDescription(p.ownerID),
 		}
 		log.Infof("Creating records: %s/%s: %s", rs.dnsName, rs.recordType, strings.Join(records, ","))
-		if p.dryRun {
-			return nil
+		if !p.dryRun {
+			rs.recordSetID, err = p.client.CreateRecordSet(ctx, rs.zoneID, opts)
 		}
-		_, err := p.client.CreateRecordSet(ctx, rs.zoneID, opts)
-		return err
 	} else if len(records) == 0 {
+		action = audit.ActionDelete
 		log.Infof("Deleting records for %s/%s", rs.dnsName, rs.recordType)
-		if p.dryRun {
-			return nil
+		if !p.dryRun {
+			err = p.client.DeleteRecordSet(ctx, rs.zoneID, rs.recordSetID)
 		}
-		return p.client.DeleteRecordSet(ctx, rs.zoneID, rs.recordSetID)
 	} else {
+		action = audit.ActionUpdate
 		opts := recordsets.UpdateOpts{
 			Records: records,
 			TTL:     &rs.ttl,
 		}
 		log.Infof("Updating records: %s/%s: %s", rs.dnsName, rs.recordType, strings.Join(records, ","))
-		if p.dryRun {
-			return nil
+		if !p.dryRun {
+			err = p.client.UpdateRecordSet(ctx, rs.zoneID, rs.recordSetID, opts)
 		}
-		return p.client.UpdateRecordSet(ctx, rs.zoneID, rs.recordSetID, opts)
 	}
+	p.auditChange(rs, managedZones, action, records, time.Since(startTime), err)
+	if !p.dryRun {
+		p.emitChangeEvent(rs, action, records, err)
+	}
+	if err == nil && !p.dryRun {
+		metrics.AppliedChangesTotal.WithLabelValues(action).Inc()
+		p.drift.recordWrite(rs, action, rs.ttl, records)
+	}
+	return action, err
+}
+
+// writes an audit log entry for a change applied to Designate
+func (p designateProvider) auditChange(rs *recordSet, managedZones map[string]string, action string, records []string, duration time.Duration, err error) {
+	if p.auditLogger == nil {
+		return
+	}
+	entry := audit.Entry{
+		Timestamp:   time.Now(),
+		Action:      action,
+		ZoneID:      rs.zoneID,
+		Zone:        managedZones[rs.zoneID],
+		Name:        rs.dnsName,
+		Type:        rs.recordType,
+		RecordSetID: rs.recordSetID,
+		OldRecords:  rs.originalRecords,
+		NewRecords:  records,
+		TTL:         rs.ttl,
+		Result:      audit.ResultSuccess,
+		Duration:    duration.Seconds(),
+	}
+	sort.Strings(entry.OldRecords)
+	sort.Strings(entry.NewRecords)
+	switch {
+	case err != nil:
+		entry.Result = audit.ResultFailure
+		entry.Error = err.Error()
+	case p.dryRun:
+		entry.Result = audit.ResultDryRun
+	}
+	p.auditLogger.Log(entry)
+}
+
+// reasons and verbs of the Kubernetes Events emitted for changes
+var changeEvents = map[string]struct{ reason, verb string }{
+	audit.ActionCreate: {"DNSRecordCreated", "Created"},
+	audit.ActionUpdate: {"DNSRecordUpdated", "Updated"},
+	audit.ActionDelete: {"DNSRecordDeleted", "Deleted"},
+}
+
+// emits a Kubernetes Event on the resource the changed records originate from
+func (p designateProvider) emitChangeEvent(rs *recordSet, action string, records []string, err error) {
+	if err != nil {
+		p.events.Eventf(rs.resource, events.TypeWarning, "DNSRecordFailed", "Failed to %s %s/%s in Designate: %v",
+			action, rs.dnsName, rs.recordType, err)
+		return
+	}
+	event := changeEvents[action]
+	if action == audit.ActionDelete {
+		p.events.Eventf(rs.resource, events.TypeNormal, event.reason, "%s %s/%s in Designate", event.verb, rs.dnsName, rs.recordType)
+		return
+	}
+	p.events.Eventf(rs.resource, events.TypeNormal, event.reason, "%s %s/%s in Designate: %s",
+		event.verb, rs.dnsName, rs.recordType, strings.Join(sortedRecords(records), ","))
 }
@@ -17,23 +17,47 @@ limitations under the License.
 package provider
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"maps"
+	"math/rand/v2"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"slices"
 	"sort"
+	"strings"
 	"sync/atomic"
 	"testing"
 
 	"github.com/gophercloud/gophercloud/v2/openstack/dns/v2/recordsets"
 	"github.com/gophercloud/gophercloud/v2/openstack/dns/v2/zones"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/metadata"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	"k8s.io/client-go/tools/record"
 
 	"sigs.k8s.io/external-dns/endpoint"
 	"sigs.k8s.io/external-dns/plan"
 	"sigs.k8s.io/external-dns/provider"
+
+	"external-dns-openstack-webhook/internal/audit"
+	"external-dns-openstack-webhook/internal/designate/client"
+	"external-dns-openstack-webhook/internal/designate/fakeserver"
+	"external-dns-openstack-webhook/internal/events"
+	"external-dns-openstack-webhook/internal/metrics"
+	"external-dns-openstack-webhook/internal/notify"
+	"external-dns-openstack-webhook/internal/zonefile"
 )
 
 var lastGeneratedDesignateID int32
@@ -115,7 +139,9 @@ func (c fakeDesignateClient) UpdateRecordSet(ctx context.Context, zoneID, record
 	if opts.Description != nil {
 		rs.Description = *opts.Description
 	}
-	rs.TTL = *opts.TTL
+	if opts.TTL != nil {
+		rs.TTL = *opts.TTL
+	}
 
 	rs.Records = opts.Records
 	return nil
@@ -130,6 +156,32 @@ func (c fakeDesignateClient) DeleteRecordSet(ctx context.Context, zoneID, record
 	return nil
 }
 
+func (c fakeDesignateClient) CreateZone(ctx context.Context, opts zones.CreateOpts) (*zones.Zone, error) {
+	for _, zone := range c.managedZones {
+		if zone.zone.Name == opts.Name {
+			return nil, fmt.Errorf("duplicate zone %s", opts.Name)
+		}
+	}
+	zone := zones.Zone{
+		ID:          generateDesignateID(),
+		Name:        opts.Name,
+		Email:       opts.Email,
+		TTL:         opts.TTL,
+		Description: opts.Description,
+		Type:        opts.Type,
+		Status:      "PENDING",
+	}
+	c.AddZone(ctx, zone)
+	return &zone, nil
+}
+
+func (c fakeDesignateClient) ListNameservers(ctx context.Context, zoneID string) ([]string, error) {
+	if c.managedZones[zoneID] == nil {
+		return nil, fmt.Errorf("unknown zone %s", zoneID)
+	}
+	return []string{"ns2.designate.test.", "ns1.designate.test."}, nil
+}
+
 func (c fakeDesignateClient) ToProvider() provider.Provider {
 	return &designateProvider{client: c}
 }
@@ -258,11 +310,11 @@ clouds:
     interface: public
     auth_type: v3applicationcredential`, ts.URL)
 
-	os.Setenv("OS_CLIENT_CONFIG_FILE", tmpcloudsyaml.Name())
-	os.Setenv("OS_CLOUD", "unittest")
-	os.Setenv("OS_CACERT", tmpfile.Name())
+	t.Setenv("OS_CLIENT_CONFIG_FILE", tmpcloudsyaml.Name())
+	t.Setenv("OS_CLOUD", "unittest")
+	t.Setenv("OS_CACERT", tmpfile.Name())
 
-	if _, err := NewDesignateProvider(endpoint.DomainFilter{}, true); err != nil {
+	if _, err := NewDesignateProvider(endpoint.DomainFilter{}, true, client.Config{}); err != nil {
 		t.Fatalf("Failed to initialize Designate provider: %s", err)
 	}
 }
@@ -724,3 +776,1721 @@ func TestGetHostZoneID(t *testing.T) {
 		})
 	}
 }
+
+func TestDesignateOwnership(t *testing.T) {
+	for _, mode := range []OwnershipMode{OwnershipFilter, OwnershipGuard} {
+		t.Run(string(mode), func(t *testing.T) {
+			client := newFakeDesignateClient()
+			ctx := context.TODO()
+
+			zoneID := client.AddZone(ctx, zones.Zone{
+				Name:   "example.com.",
+				Type:   "PRIMARY",
+				Status: "ACTIVE",
+			})
+			ownedID, _ := client.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{
+				Name:        "owned.example.com.",
+				Type:        endpoint.RecordTypeA,
+				Records:     []string{"10.1.1.1"},
+				Description: "external-dns-owner=cluster-a",
+			})
+			foreignID, _ := client.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{
+				Name:        "foreign.example.com.",
+				Type:        endpoint.RecordTypeA,
+				Records:     []string{"10.1.1.2"},
+				Description: "external-dns-owner=cluster-b",
+			})
+			manualID, _ := client.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{
+				Name:    "manual.example.com.",
+				Type:    endpoint.RecordTypeA,
+				Records: []string{"10.1.1.3"},
+			})
+
+			p := &designateProvider{client: client, ownerID: "cluster-a", ownershipMode: mode}
+
+			endpoints, err := p.Records(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantCount := 1
+			if mode == OwnershipGuard {
+				wantCount = 3
+			}
+			if len(endpoints) != wantCount {
+				t.Fatalf("got %d endpoints, want %d: %v", len(endpoints), wantCount, endpoints)
+			}
+
+			deletes := append(endpoints, &endpoint.Endpoint{
+				DNSName:    "manual.example.com",
+				RecordType: endpoint.RecordTypeA,
+				Targets:    endpoint.Targets{"10.1.1.3"},
+				Labels: map[string]string{
+					designateZoneID:          zoneID,
+					designateRecordSetID:     manualID,
+					designateOriginalRecords: "10.1.1.3",
+				},
+			})
+			creates := []*endpoint.Endpoint{
+				{
+					DNSName:    "new.example.com",
+					RecordType: endpoint.RecordTypeA,
+					Targets:    endpoint.Targets{"10.1.1.4"},
+					Labels:     map[string]string{},
+				},
+			}
+			if err := p.ApplyChanges(ctx, &plan.Changes{Create: creates, Delete: deletes}); err != nil {
+				t.Fatal(err)
+			}
+
+			recordSets := client.managedZones[zoneID].recordSets
+			if _, ok := recordSets[ownedID]; ok {
+				t.Errorf("owned record-set was not deleted")
+			}
+			if _, ok := recordSets[foreignID]; !ok {
+				t.Errorf("record-set of another owner was deleted")
+			}
+			if _, ok := recordSets[manualID]; !ok {
+				t.Errorf("record-set without owner was deleted")
+			}
+			created := false
+			for _, rs := range recordSets {
+				if rs.Name == "new.example.com." {
+					created = true
+					if rs.Description != "external-dns-owner=cluster-a" {
+						t.Errorf("created record-set has description %q", rs.Description)
+					}
+				}
+			}
+			if !created {
+				t.Errorf("record-set was not created")
+			}
+		})
+	}
+}
+
+func TestDesignateProtectedRecords(t *testing.T) {
+	client := newFakeDesignateClient()
+	ctx := context.TODO()
+
+	zoneID := client.AddZone(ctx, zones.Zone{
+		Name:   "example.com.",
+		Type:   "PRIMARY",
+		Status: "ACTIVE",
+	})
+	apexID, _ := client.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{
+		Name:    "example.com.",
+		Type:    endpoint.RecordTypeA,
+		Records: []string{"10.1.1.1"},
+	})
+	markedID, _ := client.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{
+		Name:        "marked.example.com.",
+		Type:        endpoint.RecordTypeA,
+		Records:     []string{"10.1.1.2"},
+		Description: "hand-made; external-dns-protected",
+	})
+	mailID, _ := client.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{
+		Name:    "mail.example.com.",
+		Type:    endpoint.RecordTypeA,
+		Records: []string{"10.1.1.3"},
+	})
+	otherID, _ := client.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{
+		Name:    "other.example.com.",
+		Type:    endpoint.RecordTypeA,
+		Records: []string{"10.1.1.4"},
+	})
+
+	p := &designateProvider{client: client}
+	WithProtectedRecords([]string{"example.com"}, []*regexp.Regexp{regexp.MustCompile(`^mail\.`)})(p)
+
+	endpoints, err := p.Records(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creates := []*endpoint.Endpoint{
+		{
+			DNSName:    "mail.example.com",
+			RecordType: endpoint.RecordTypeTXT,
+			Targets:    endpoint.Targets{"text"},
+			Labels:     map[string]string{},
+		},
+	}
+	if err := p.ApplyChanges(ctx, &plan.Changes{Create: creates, Delete: endpoints}); err != nil {
+		t.Fatal(err)
+	}
+
+	recordSets := client.managedZones[zoneID].recordSets
+	for _, id := range []string{apexID, markedID, mailID} {
+		if _, ok := recordSets[id]; !ok {
+			t.Errorf("protected record-set %s was deleted", id)
+		}
+	}
+	if _, ok := recordSets[otherID]; ok {
+		t.Errorf("unprotected record-set was not deleted")
+	}
+	if len(recordSets) != 3 {
+		t.Errorf("got %d record-sets, want 3", len(recordSets))
+	}
+}
+
+func TestDesignateDeletionThreshold(t *testing.T) {
+	tests := []struct {
+		name        string
+		threshold   Option
+		wantErr     bool
+		wantDeleted bool
+	}{
+		{
+			name:        "no threshold",
+			threshold:   WithDeletionThreshold(0, 0, false),
+			wantDeleted: true,
+		},
+		{
+			name:        "below count threshold",
+			threshold:   WithDeletionThreshold(2, 0, false),
+			wantDeleted: true,
+		},
+		{
+			name:      "above count threshold",
+			threshold: WithDeletionThreshold(1, 0, false),
+			wantErr:   true,
+		},
+		{
+			name:      "above percentage threshold",
+			threshold: WithDeletionThreshold(0, 50, false),
+			wantErr:   true,
+		},
+		{
+			name:        "above threshold with override",
+			threshold:   WithDeletionThreshold(1, 50, true),
+			wantDeleted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newFakeDesignateClient()
+			ctx := context.TODO()
+
+			zoneID := client.AddZone(ctx, zones.Zone{
+				Name:   "example.com.",
+				Type:   "PRIMARY",
+				Status: "ACTIVE",
+			})
+			for i := 1; i <= 3; i++ {
+				client.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{
+					Name:    fmt.Sprintf("www%d.example.com.", i),
+					Type:    endpoint.RecordTypeA,
+					Records: []string{fmt.Sprintf("10.1.1.%d", i)},
+				})
+			}
+
+			p := &designateProvider{client: client}
+			tt.threshold(p)
+
+			endpoints, err := p.Records(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			creates := []*endpoint.Endpoint{
+				{
+					DNSName:    "new.example.com",
+					RecordType: endpoint.RecordTypeA,
+					Targets:    endpoint.Targets{"10.1.1.9"},
+					Labels:     map[string]string{},
+				},
+			}
+			err = p.ApplyChanges(ctx, &plan.Changes{Create: creates, Delete: endpoints[:2]})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error: %v", err, tt.wantErr)
+			}
+
+			wantCount := 4
+			if tt.wantDeleted {
+				wantCount = 2
+			}
+			if got := len(client.managedZones[zoneID].recordSets); got != wantCount {
+				t.Errorf("got %d record-sets, want %d", got, wantCount)
+			}
+		})
+	}
+}
+
+func TestDesignateAuditLog(t *testing.T) {
+	client := newFakeDesignateClient()
+	expected := testDesignateCreateRecords(t, client)
+
+	var buf bytes.Buffer
+	p := &designateProvider{client: client, auditLogger: audit.NewStreamLogger(&buf)}
+
+	updatesOld := []*endpoint.Endpoint{
+		{
+			DNSName:    "ftp.example.com",
+			RecordType: endpoint.RecordTypeA,
+			Targets:    endpoint.Targets{"10.1.1.2"},
+			RecordTTL:  120,
+			Labels: map[string]string{
+				designateZoneID:          "zone-1",
+				designateRecordSetID:     expected[2].ID,
+				designateOriginalRecords: "10.1.1.2",
+			},
+		},
+	}
+	updatesNew := []*endpoint.Endpoint{
+		{
+			DNSName:    "ftp.example.com",
+			RecordType: endpoint.RecordTypeA,
+			Targets:    endpoint.Targets{"10.3.3.1"},
+			RecordTTL:  60,
+			Labels: map[string]string{
+				designateZoneID:          "zone-1",
+				designateRecordSetID:     expected[2].ID,
+				designateOriginalRecords: "10.1.1.2",
+			},
+		},
+	}
+	err := p.ApplyChanges(context.Background(), &plan.Changes{UpdateOld: updatesOld, UpdateNew: updatesNew})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var entry audit.Entry
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid audit log %q: %v", buf.String(), err)
+	}
+	if entry.Action != audit.ActionUpdate || entry.ZoneID != "zone-1" || entry.Name != "ftp.example.com." ||
+		entry.RecordSetID != expected[2].ID || entry.TTL != 60 || entry.Result != audit.ResultSuccess ||
+		!reflect.DeepEqual(entry.OldRecords, []string{"10.1.1.2"}) || !reflect.DeepEqual(entry.NewRecords, []string{"10.3.3.1"}) {
+		t.Errorf("unexpected audit log entry %+v", entry)
+	}
+}
+
+type failingDesignateClient struct {
+	*fakeDesignateClient
+	failNames map[string]bool
+}
+
+func (c failingDesignateClient) CreateRecordSet(ctx context.Context, zoneID string, opts recordsets.CreateOpts) (string, error) {
+	if c.failNames[opts.Name] {
+		return "", fmt.Errorf("injected failure for %s", opts.Name)
+	}
+	return c.fakeDesignateClient.CreateRecordSet(ctx, zoneID, opts)
+}
+
+func TestDesignateTransactionalRollback(t *testing.T) {
+	client := newFakeDesignateClient()
+	ctx := context.TODO()
+
+	zoneID := client.AddZone(ctx, zones.Zone{
+		Name:   "example.com.",
+		Type:   "PRIMARY",
+		Status: "ACTIVE",
+	})
+	client.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{
+		Name:    "upd.example.com.",
+		Type:    endpoint.RecordTypeA,
+		TTL:     120,
+		Records: []string{"10.1.1.1"},
+	})
+	client.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{
+		Name:        "del.example.com.",
+		Type:        endpoint.RecordTypeA,
+		TTL:         300,
+		Records:     []string{"10.1.1.2", "10.1.1.3"},
+		Description: "legacy record external-dns-owner=other",
+	})
+
+	snapshot := func() map[string]string {
+		result := map[string]string{}
+		for _, rs := range client.managedZones[zoneID].recordSets {
+			records := append([]string{}, rs.Records...)
+			sort.Strings(records)
+			result[rs.Name+"/"+rs.Type] = fmt.Sprintf("%d %v %q", rs.TTL, records, rs.Description)
+		}
+		return result
+	}
+	before := snapshot()
+
+	recorder := record.NewFakeRecorder(20)
+	p := &designateProvider{
+		client:        failingDesignateClient{client, map[string]bool{"fail.example.com.": true}},
+		transactional: true,
+		events:        events.NewRecorderFor(recorder, newFakeKubernetesObjects(t), "pod/dns/webhook"),
+	}
+	defer p.events.Close()
+	endpoints, err := p.Records(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var updateOld, updateNew, deletes []*endpoint.Endpoint
+	for _, ep := range endpoints {
+		if ep.DNSName == "upd.example.com" {
+			updateOld = append(updateOld, ep)
+			updateNew = append(updateNew, &endpoint.Endpoint{
+				DNSName:    ep.DNSName,
+				RecordType: ep.RecordType,
+				Targets:    endpoint.Targets{"10.9.9.9"},
+				RecordTTL:  60,
+				Labels:     ep.Labels,
+			})
+		} else {
+			deletes = append(deletes, ep)
+		}
+	}
+	creates := []*endpoint.Endpoint{
+		{DNSName: "new.example.com", RecordType: endpoint.RecordTypeA, Targets: endpoint.Targets{"10.2.2.1"}, Labels: map[string]string{}},
+		{DNSName: "fail.example.com", RecordType: endpoint.RecordTypeA, Targets: endpoint.Targets{"10.2.2.2"}, Labels: map[string]string{}},
+	}
+
+	summary, err := p.ApplyChangesWithSummary(ctx, &plan.Changes{Create: creates, UpdateOld: updateOld, UpdateNew: updateNew, Delete: deletes})
+	if err == nil {
+		t.Fatal("expected error from failing change")
+	}
+
+	if after := snapshot(); !reflect.DeepEqual(before, after) {
+		t.Errorf("state was not rolled back: before=%v after=%v", before, after)
+	}
+	// every applied change is reported as rolled back, and emits an event when applied and when reverted
+	applied := len(summary.Created) + len(summary.Updated) + len(summary.Deleted)
+	if len(summary.RolledBack) != applied || len(summary.Failed) != 1 {
+		t.Errorf("got %d rolled back and %d failed changes for %d applied ones: %+v", len(summary.RolledBack), len(summary.Failed), applied, summary)
+	}
+	for _, c := range summary.RolledBack {
+		if c.Error != "" {
+			t.Errorf("rollback of %s %s failed: %s", c.Action, c.Name, c.Error)
+		}
+	}
+	p.events.Flush()
+	if got, want := len(recorder.Events), 2*applied+1; got != want {
+		t.Errorf("got %d events, want %d", got, want)
+	}
+
+	// a deleted recordset is recreated with its original description
+	for id, existing := range client.managedZones[zoneID].recordSets {
+		if existing.Name != "del.example.com." {
+			continue
+		}
+		client.DeleteRecordSet(ctx, zoneID, id)
+		deleted := &recordSet{dnsName: existing.Name, recordType: existing.Type, zoneID: zoneID, recordSetID: id,
+			originalRecords: existing.Records, originalTTL: existing.TTL, originalDescription: existing.Description}
+		if err := p.revertChange(ctx, appliedChange{rs: deleted, action: audit.ActionDelete}, nil, &notify.Summary{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if after := snapshot(); !reflect.DeepEqual(before, after) {
+		t.Errorf("deletion was not reverted: before=%v after=%v", before, after)
+	}
+
+	// a recordset of unknown records is not restored without records
+	rs := &recordSet{dnsName: "gone.example.com.", recordType: endpoint.RecordTypeA, zoneID: zoneID, recordSetID: "gone"}
+	for _, action := range []string{audit.ActionUpdate, audit.ActionDelete} {
+		if err := p.revertChange(ctx, appliedChange{rs: rs, action: action}, nil, &notify.Summary{}); !errors.Is(err, errUnknownOriginalRecords) {
+			t.Errorf("got %v reverting %s, expected unknown original records", err, action)
+		}
+	}
+	if after := snapshot(); !reflect.DeepEqual(before, after) {
+		t.Errorf("revert without original records changed the state: before=%v after=%v", before, after)
+	}
+}
+
+func TestDesignateZoneCreation(t *testing.T) {
+	client := newFakeDesignateClient()
+	ctx := context.TODO()
+
+	client.AddZone(ctx, zones.Zone{
+		Name:   "example.com.",
+		Type:   "PRIMARY",
+		Status: "ACTIVE",
+	})
+
+	p := &designateProvider{client: client}
+	WithZoneCreation([]string{"apps.example.org"}, "admin@example.org", 600, "auto")(p)
+
+	creates := []*endpoint.Endpoint{
+		{DNSName: "www.team-a.apps.example.org", RecordType: endpoint.RecordTypeA, Targets: endpoint.Targets{"10.1.1.1"}, Labels: map[string]string{}},
+		{DNSName: "api.team-a.apps.example.org", RecordType: endpoint.RecordTypeA, Targets: endpoint.Targets{"10.1.1.2"}, Labels: map[string]string{}},
+		{DNSName: "team-b.apps.example.org", RecordType: endpoint.RecordTypeA, Targets: endpoint.Targets{"10.1.1.3"}, Labels: map[string]string{}},
+		{DNSName: "www.other.org", RecordType: endpoint.RecordTypeA, Targets: endpoint.Targets{"10.1.1.4"}, Labels: map[string]string{}},
+	}
+	if err := p.ApplyChanges(ctx, &plan.Changes{Create: creates}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string][]string{}
+	for _, zone := range client.managedZones {
+		if zone.zone.Name == "example.com." {
+			continue
+		}
+		if zone.zone.Email != "admin@example.org" || zone.zone.TTL != 600 || zone.zone.Description != "auto" {
+			t.Errorf("unexpected zone settings %+v", zone.zone)
+		}
+		for _, rs := range zone.recordSets {
+			got[zone.zone.Name] = append(got[zone.zone.Name], rs.Name)
+		}
+		sort.Strings(got[zone.zone.Name])
+	}
+	want := map[string][]string{
+		"team-a.apps.example.org.": {"api.team-a.apps.example.org.", "www.team-a.apps.example.org."},
+		"team-b.apps.example.org.": {"team-b.apps.example.org."},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got zones %v, want %v", got, want)
+	}
+
+	// dry-run previews the records in the zones that would be created, even with strict zone matching
+	dryRunClient := newFakeDesignateClient()
+	dryRunClient.AddZone(ctx, zones.Zone{
+		Name:   "svc.team-a.apps.example.org.",
+		Type:   "PRIMARY",
+		Status: "ACTIVE",
+	})
+	unmatched := NewUnmatchedRecords()
+	p = &designateProvider{client: dryRunClient, dryRun: true, strictZoneMatching: true, unmatchedRecords: unmatched}
+	WithZoneCreation([]string{"apps.example.org"}, "admin@example.org", 600, "auto")(p)
+	WithDelegation()(p)
+	skipped := testutil.ToFloat64(metrics.SkippedRecordsTotal.WithLabelValues(skipReasonNoZone, endpoint.RecordTypeA))
+	if err := p.ApplyChanges(ctx, &plan.Changes{Create: creates[:3]}); err != nil {
+		t.Fatalf("dry-run failed: %v", err)
+	}
+	if len(dryRunClient.managedZones) != 1 || len(dryRunClient.managedZones["svc.team-a.apps.example.org."].recordSets) != 0 {
+		t.Error("dry-run changed Designate")
+	}
+	if got := testutil.ToFloat64(metrics.SkippedRecordsTotal.WithLabelValues(skipReasonNoZone, endpoint.RecordTypeA)) - skipped; got != 0 {
+		t.Errorf("dry-run skipped %v records for lack of a zone", got)
+	}
+	if list := unmatched.List(); len(list) != 0 {
+		t.Errorf("dry-run reported unmatched records %v", list)
+	}
+}
+
+// nameserverCountingClient counts the nameserver lookups per zone
+type nameserverCountingClient struct {
+	*fakeDesignateClient
+	lookups map[string]int
+}
+
+func (c nameserverCountingClient) ListNameservers(ctx context.Context, zoneID string) ([]string, error) {
+	c.lookups[zoneID]++
+	return c.fakeDesignateClient.ListNameservers(ctx, zoneID)
+}
+
+func TestDesignateDelegation(t *testing.T) {
+	client := newFakeDesignateClient()
+	ctx := context.TODO()
+
+	for _, name := range []string{"example.com.", "apps.example.com.", "team-a.apps.example.com.", "team-b.apps.example.com.", "other.org."} {
+		client.AddZone(ctx, zones.Zone{
+			Name:   name,
+			Type:   "PRIMARY",
+			Status: "ACTIVE",
+		})
+	}
+	staleID, _ := client.CreateRecordSet(ctx, "apps.example.com.", recordsets.CreateOpts{
+		Name:    "team-b.apps.example.com.",
+		Type:    recordTypeNS,
+		TTL:     3600,
+		Records: []string{"ns-old.designate.test."},
+	})
+
+	counting := nameserverCountingClient{fakeDesignateClient: client, lookups: map[string]int{}}
+	p := &designateProvider{client: counting}
+	WithDelegation()(p)
+
+	for i := 0; i < 2; i++ {
+		if err := p.ApplyChanges(ctx, &plan.Changes{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// synced delegations are only synced again for batches changing the child zone
+	wantLookups := map[string]int{"apps.example.com.": 1, "team-a.apps.example.com.": 1, "team-b.apps.example.com.": 1}
+	if !reflect.DeepEqual(counting.lookups, wantLookups) {
+		t.Errorf("got nameserver lookups %v, want %v", counting.lookups, wantLookups)
+	}
+	creates := []*endpoint.Endpoint{
+		{DNSName: "www.team-a.apps.example.com", RecordType: endpoint.RecordTypeA, Targets: endpoint.Targets{"10.1.1.1"}, Labels: map[string]string{}},
+		{DNSName: "www.other.org", RecordType: endpoint.RecordTypeA, Targets: endpoint.Targets{"10.1.1.2"}, Labels: map[string]string{}},
+	}
+	if err := p.ApplyChanges(ctx, &plan.Changes{Create: creates}); err != nil {
+		t.Fatal(err)
+	}
+	wantLookups["team-a.apps.example.com."]++
+	if !reflect.DeepEqual(counting.lookups, wantLookups) {
+		t.Errorf("got nameserver lookups %v, want %v", counting.lookups, wantLookups)
+	}
+
+	got := map[string]string{}
+	for zoneID, zone := range client.managedZones {
+		for id, rs := range zone.recordSets {
+			if rs.Type != recordTypeNS {
+				continue
+			}
+			if rs.Name == "team-b.apps.example.com." && id != staleID {
+				t.Errorf("stale NS record-set was replaced instead of updated")
+			}
+			records := append([]string{}, rs.Records...)
+			sort.Strings(records)
+			got[zoneID+" "+rs.Name] = fmt.Sprint(records)
+		}
+	}
+	want := map[string]string{
+		"example.com. apps.example.com.":             "[ns1.designate.test. ns2.designate.test.]",
+		"apps.example.com. team-a.apps.example.com.": "[ns1.designate.test. ns2.designate.test.]",
+		"apps.example.com. team-b.apps.example.com.": "[ns1.designate.test. ns2.designate.test.]",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got delegations %v, want %v", got, want)
+	}
+}
+
+func TestDesignateUnmatchedRecords(t *testing.T) {
+	client := newFakeDesignateClient()
+	ctx := context.TODO()
+
+	client.AddZone(ctx, zones.Zone{
+		Name:   "example.com.",
+		Type:   "PRIMARY",
+		Status: "ACTIVE",
+	})
+
+	unmatched := NewUnmatchedRecords()
+	p := &designateProvider{client: client, unmatchedRecords: unmatched}
+
+	creates := []*endpoint.Endpoint{
+		{DNSName: "www.example.com", RecordType: endpoint.RecordTypeA, Targets: endpoint.Targets{"10.1.1.1"}, Labels: map[string]string{}},
+		{DNSName: "www.other.org", RecordType: endpoint.RecordTypeA, Targets: endpoint.Targets{"10.1.1.2"}, Labels: map[string]string{}},
+	}
+	if err := p.ApplyChanges(ctx, &plan.Changes{Create: creates}); err != nil {
+		t.Fatal(err)
+	}
+	list := unmatched.List()
+	if len(list) != 1 || list[0].Name != "www.other.org." || list[0].Type != endpoint.RecordTypeA || list[0].Count != 1 {
+		t.Errorf("unexpected unmatched records %+v", list)
+	}
+
+	rec := httptest.NewRecorder()
+	unmatched.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/unmatched", nil))
+	var served []UnmatchedRecord
+	if err := json.Unmarshal(rec.Body.Bytes(), &served); err != nil || len(served) != 1 {
+		t.Errorf("unexpected response %q: %v", rec.Body.String(), err)
+	}
+
+	WithStrictZoneMatching()(p)
+	err := p.ApplyChanges(ctx, &plan.Changes{Create: creates[1:]})
+	if err == nil {
+		t.Error("expected error for unmatched record in strict mode")
+	}
+	if list := unmatched.List(); len(list) != 1 || list[0].Count != 2 {
+		t.Errorf("unexpected unmatched records %+v", list)
+	}
+
+	client.AddZone(ctx, zones.Zone{
+		Name:   "other.org.",
+		Type:   "PRIMARY",
+		Status: "ACTIVE",
+	})
+	if err := p.ApplyChanges(ctx, &plan.Changes{Create: creates[1:]}); err != nil {
+		t.Fatal(err)
+	}
+	if list := unmatched.List(); len(list) != 0 {
+		t.Errorf("record is still unmatched after its zone was created: %+v", list)
+	}
+}
+
+func TestDesignateDebugInfo(t *testing.T) {
+	client := newFakeDesignateClient()
+	ctx := context.TODO()
+
+	zoneID := client.AddZone(ctx, zones.Zone{
+		Name:   "example.com.",
+		Type:   "PRIMARY",
+		Status: "ACTIVE",
+	})
+	client.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{
+		Name:    "www.example.com.",
+		Type:    endpoint.RecordTypeA,
+		Records: []string{"10.1.1.1"},
+	})
+
+	debugInfo := NewDebugInfo()
+	p := &designateProvider{client: client}
+	WithDebugInfo(debugInfo)(p)
+	mux := http.NewServeMux()
+	debugInfo.RegisterHandlers(mux)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	var gotZones []Zone
+	if err := json.Unmarshal(get("/debug/zones").Body.Bytes(), &gotZones); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotZones, []Zone{{ID: zoneID, Name: "example.com."}}) {
+		t.Errorf("unexpected zones %v", gotZones)
+	}
+
+	var gotRecords []*endpoint.Endpoint
+	if err := json.Unmarshal(get("/debug/records").Body.Bytes(), &gotRecords); err != nil {
+		t.Fatal(err)
+	}
+	if len(gotRecords) != 1 || gotRecords[0].Labels[designateZoneID] != zoneID {
+		t.Errorf("unexpected records %v", gotRecords)
+	}
+
+	if rec := get("/debug/apply"); rec.Code != http.StatusNotFound {
+		t.Errorf("got status %d before first apply, want %d", rec.Code, http.StatusNotFound)
+	}
+	creates := []*endpoint.Endpoint{
+		{DNSName: "ftp.example.com", RecordType: endpoint.RecordTypeA, Targets: endpoint.Targets{"10.1.1.2"}, Labels: map[string]string{}},
+	}
+	if err := p.ApplyChanges(ctx, &plan.Changes{Create: creates}); err != nil {
+		t.Fatal(err)
+	}
+	var gotApply DebugApply
+	if err := json.Unmarshal(get("/debug/apply").Body.Bytes(), &gotApply); err != nil {
+		t.Fatal(err)
+	}
+	if gotApply.Error != "" || len(gotApply.Changes.Create) != 1 || gotApply.Changes.Create[0].DNSName != "ftp.example.com" {
+		t.Errorf("unexpected last apply %+v", gotApply)
+	}
+}
+
+func TestDesignateExportZone(t *testing.T) {
+	client := newFakeDesignateClient()
+	ctx := context.TODO()
+
+	zoneID := client.AddZone(ctx, zones.Zone{
+		Name:   "example.com.",
+		Type:   "PRIMARY",
+		Status: "ACTIVE",
+	})
+	client.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{
+		Name:    "example.com.",
+		Type:    "SOA",
+		TTL:     3600,
+		Records: []string{"ns1.designate.test. admin.example.com. 1 3600 600 86400 3600"},
+	})
+	client.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{
+		Name:    "www.example.com.",
+		Type:    endpoint.RecordTypeA,
+		TTL:     300,
+		Records: []string{"10.1.1.1"},
+	})
+	client.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{
+		Name:        "mail.example.com.",
+		Type:        "MX",
+		Records:     []string{"10 mx.example.com."},
+		Description: ownerDescription("other"),
+	})
+
+	p := &designateProvider{client: client}
+	WithOwnership("me", OwnershipFilter)(p)
+
+	var buf bytes.Buffer
+	if err := p.ExportZone(ctx, Zone{ID: zoneID, Name: "example.com."}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := "$ORIGIN example.com.\n" +
+		"@\t3600\tIN\tSOA\tns1.designate.test. admin.example.com. 1 3600 600 86400 3600\n" +
+		"mail\t\tIN\tMX\t10 mx.example.com.\n" +
+		"www\t300\tIN\tA\t10.1.1.1\n"
+	if buf.String() != expected {
+		t.Errorf("got\n%s\nexpected\n%s", buf.String(), expected)
+	}
+}
+
+func TestDesignateImportZone(t *testing.T) {
+	client := newFakeDesignateClient()
+	ctx := context.TODO()
+
+	zoneID := client.AddZone(ctx, zones.Zone{
+		Name:   "example.com.",
+		Type:   "PRIMARY",
+		Status: "ACTIVE",
+		TTL:    3600,
+	})
+	for _, opts := range []recordsets.CreateOpts{
+		{Name: "example.com.", Type: "NS", Records: []string{"ns1.designate.test."}},
+		{Name: "same.example.com.", Type: endpoint.RecordTypeA, Records: []string{"10.1.1.1"}},
+		{Name: "changed.example.com.", Type: endpoint.RecordTypeA, TTL: 300, Records: []string{"10.1.1.2"}},
+		{Name: "extra.example.com.", Type: endpoint.RecordTypeTXT, Records: []string{`"extra"`}},
+		{Name: "locked.example.com.", Type: endpoint.RecordTypeA, Records: []string{"10.1.1.3"}, Description: protectedDescriptionMarker},
+		{Name: "filtered.example.com.", Type: endpoint.RecordTypeA, Records: []string{"10.1.1.4"}},
+	} {
+		client.CreateRecordSet(ctx, zoneID, opts)
+	}
+
+	zoneFile := `$TTL 3600
+@	IN	SOA	ns1.example.net. admin.example.com. 2 3600 600 86400 3600
+@	IN	NS	ns1.example.net.
+same	IN	A	10.1.1.1
+changed	300	IN	A	10.1.1.9
+locked	IN	A	10.1.1.8
+new	60	IN	MX	10 mail.example.com.
+www.other.org.	IN	A	10.1.1.5
+`
+	recordSets, err := zonefile.Parse(strings.NewReader(zoneFile), "example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zone := Zone{ID: zoneID, Name: "example.com.", TTL: 3600}
+	domainFilter := endpoint.NewDomainFilterWithExclusions([]string{"example.com"}, []string{"filtered.example.com"})
+
+	p := &designateProvider{client: client, domainFilter: *domainFilter, dryRun: true}
+	changes, err := p.ImportZone(ctx, zone, recordSets, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ImportChange{
+		{Action: audit.ActionUpdate, Name: "changed.example.com.", Type: "A", TTL: 300, OldTTL: 300, OldRecords: []string{"10.1.1.2"}, NewRecords: []string{"10.1.1.9"}},
+		{Action: audit.ActionDelete, Name: "extra.example.com.", Type: "TXT", OldRecords: []string{`"extra"`}},
+		{Action: audit.ActionUpdate, Name: "locked.example.com.", Type: "A", TTL: 3600, OldRecords: []string{"10.1.1.3"}, NewRecords: []string{"10.1.1.8"}, Skipped: true},
+		{Action: audit.ActionCreate, Name: "new.example.com.", Type: "MX", TTL: 60, NewRecords: []string{"10 mail.example.com."}},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("got changes %+v, expected %+v", changes, expected)
+	}
+	if len(client.managedZones[zoneID].recordSets) != 6 {
+		t.Errorf("dry-run import changed the zone")
+	}
+
+	p.dryRun = false
+	if _, err := p.ImportZone(ctx, zone, recordSets, false); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string][]string{}
+	for _, rs := range client.managedZones[zoneID].recordSets {
+		got[rs.Name+"/"+rs.Type] = rs.Records
+	}
+	expectedRecords := map[string][]string{
+		"example.com./NS":         {"ns1.designate.test."},
+		"same.example.com./A":     {"10.1.1.1"},
+		"changed.example.com./A":  {"10.1.1.9"},
+		"extra.example.com./TXT":  {`"extra"`},
+		"locked.example.com./A":   {"10.1.1.3"},
+		"filtered.example.com./A": {"10.1.1.4"},
+		"new.example.com./MX":     {"10 mail.example.com."},
+	}
+	if !reflect.DeepEqual(got, expectedRecords) {
+		t.Errorf("got recordsets %v, expected %v", got, expectedRecords)
+	}
+}
+
+func TestDesignateClaimRecordSets(t *testing.T) {
+	client := newFakeDesignateClient()
+	ctx := context.TODO()
+
+	zoneID := client.AddZone(ctx, zones.Zone{
+		Name:   "example.com.",
+		Type:   "PRIMARY",
+		Status: "ACTIVE",
+	})
+	unowned, _ := client.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{
+		Name: "www.example.com.", Type: endpoint.RecordTypeA, Records: []string{"10.1.1.1"}, Description: "legacy record",
+	})
+	foreign, _ := client.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{
+		Name: "mail.example.com.", Type: endpoint.RecordTypeA, Records: []string{"10.1.1.2"}, Description: ownerDescription("other"),
+	})
+	protected, _ := client.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{
+		Name: "ns.example.com.", Type: endpoint.RecordTypeA, Records: []string{"10.1.1.3"}, Description: protectedDescriptionMarker,
+	})
+
+	p := &designateProvider{client: client, dryRun: true}
+	WithOwnership("me", OwnershipGuard)(p)
+	endpoints, err := p.Records(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed, err := p.ClaimRecordSets(ctx, endpoints); err != nil || claimed != 1 {
+		t.Errorf("got %d claimed in dry-run: %v", claimed, err)
+	}
+	if d := client.managedZones[zoneID].recordSets[unowned].Description; d != "legacy record" {
+		t.Errorf("dry-run claim changed description to %q", d)
+	}
+
+	p.dryRun = false
+	if claimed, err := p.ClaimRecordSets(ctx, endpoints); err != nil || claimed != 1 {
+		t.Errorf("got %d claimed: %v", claimed, err)
+	}
+	recordSets := client.managedZones[zoneID].recordSets
+	if d := recordSets[unowned].Description; d != "legacy record "+ownerDescription("me") {
+		t.Errorf("unexpected description %q of claimed recordset", d)
+	}
+	if !reflect.DeepEqual(recordSets[unowned].Records, []string{"10.1.1.1"}) {
+		t.Errorf("claiming changed records to %v", recordSets[unowned].Records)
+	}
+	if d := recordSets[foreign].Description; d != ownerDescription("other") {
+		t.Errorf("recordset of other owner was claimed: %q", d)
+	}
+	if d := recordSets[protected].Description; d != protectedDescriptionMarker {
+		t.Errorf("protected recordset was claimed: %q", d)
+	}
+	if claimed, err := p.ClaimRecordSets(ctx, endpoints); err != nil || claimed != 0 {
+		t.Errorf("got %d claimed on second run: %v", claimed, err)
+	}
+}
+
+func TestDesignateMetrics(t *testing.T) {
+	client := newFakeDesignateClient()
+	ctx := context.TODO()
+
+	zoneID := client.AddZone(ctx, zones.Zone{
+		Name:   "metrics.example.",
+		Type:   "PRIMARY",
+		Status: "ACTIVE",
+	})
+	client.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{Name: "metrics.example.", Type: "NS", Records: []string{"ns1.designate.test."}})
+	client.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{Name: "www.metrics.example.", Type: endpoint.RecordTypeA, Records: []string{"10.1.1.1"}})
+
+	p := &designateProvider{client: client}
+	created := testutil.ToFloat64(metrics.AppliedChangesTotal.WithLabelValues(audit.ActionCreate))
+	creates := []*endpoint.Endpoint{
+		{DNSName: "ftp.metrics.example", RecordType: endpoint.RecordTypeA, Targets: endpoint.Targets{"10.1.1.2"}, Labels: map[string]string{}},
+	}
+	if err := p.ApplyChanges(ctx, &plan.Changes{Create: creates}); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(metrics.AppliedChangesTotal.WithLabelValues(audit.ActionCreate)) - created; got != 1 {
+		t.Errorf("got %v creates counted, expected 1", got)
+	}
+
+	if _, err := p.Records(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(metrics.ManagedZones); got != 1 {
+		t.Errorf("got %v managed zones, expected 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.RecordSets.WithLabelValues("metrics.example.", endpoint.RecordTypeA)); got != 2 {
+		t.Errorf("got %v A recordsets, expected 2", got)
+	}
+	if got := testutil.ToFloat64(metrics.RecordSets.WithLabelValues("metrics.example.", "NS")); got != 1 {
+		t.Errorf("got %v NS recordsets, expected 1", got)
+	}
+}
+
+func TestDesignateSyncStatus(t *testing.T) {
+	client := newFakeDesignateClient()
+	ctx := context.TODO()
+
+	zoneID := client.AddZone(ctx, zones.Zone{
+		Name:   "status.example.",
+		Type:   "PRIMARY",
+		Status: "ACTIVE",
+	})
+	client.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{Name: "www.status.example.", Type: endpoint.RecordTypeA, Records: []string{"10.1.1.1"}})
+
+	syncStatus := NewSyncStatus()
+	debugInfo := NewDebugInfo()
+	p := &designateProvider{client: client, syncStatus: syncStatus}
+	WithDebugInfo(debugInfo)(p)
+	if _, err := p.Records(ctx); err != nil {
+		t.Fatal(err)
+	}
+	lastRecords := *syncStatus.Status()[operationRecords].LastSuccess
+	deletes := []*endpoint.Endpoint{{
+		DNSName:    "www.status.example",
+		RecordType: endpoint.RecordTypeA,
+		Targets:    endpoint.Targets{"10.1.1.1"},
+		Labels:     map[string]string{ZoneIDLabel: "unknown", RecordSetIDLabel: "unknown"},
+	}}
+	for range 2 {
+		if err := p.ApplyChanges(ctx, &plan.Changes{Delete: deletes}); err == nil {
+			t.Fatal("expected deleting an unknown recordset to fail")
+		}
+	}
+
+	status := syncStatus.Status()
+	if records := status[operationRecords]; records.LastSuccess == nil || records.LastFailure != nil || records.ConsecutiveFailures != 0 {
+		t.Errorf("unexpected records status %+v", records)
+	}
+	if apply := status[operationApplyChanges]; apply.LastSuccess != nil || apply.LastFailure == nil || apply.LastError == "" || apply.ConsecutiveFailures != 2 {
+		t.Errorf("unexpected apply changes status %+v", apply)
+	}
+	if got := testutil.ToFloat64(metrics.ConsecutiveFailures.WithLabelValues(operationApplyChanges)); got != 2 {
+		t.Errorf("got %v consecutive failures, expected 2", got)
+	}
+	if got := testutil.ToFloat64(metrics.LastSuccessTimestamp.WithLabelValues(operationRecords)); got == 0 {
+		t.Error("last success of records was not recorded")
+	}
+
+	// inspecting the records is no sync by external-dns
+	rec := httptest.NewRecorder()
+	debugInfo.serveRecords(rec, httptest.NewRequest(http.MethodGet, "/debug/records", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d from /debug/records", rec.Code)
+	}
+	if last := syncStatus.Status()[operationRecords].LastSuccess; !last.Equal(lastRecords) {
+		t.Errorf("/debug/records changed the last success of records from %v to %v", lastRecords, last)
+	}
+
+	if err := p.ApplyChanges(ctx, &plan.Changes{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(metrics.ConsecutiveFailures.WithLabelValues(operationApplyChanges)); got != 0 {
+		t.Errorf("got %v consecutive failures after success, expected 0", got)
+	}
+
+	rec = httptest.NewRecorder()
+	syncStatus.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	var served map[string]OperationStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &served); err != nil {
+		t.Fatal(err)
+	}
+	if served[operationApplyChanges].LastSuccess == nil {
+		t.Errorf("served status lacks last success of apply changes: %s", rec.Body.String())
+	}
+}
+
+// partialObject creates the metadata of a Kubernetes object events are emitted on
+func partialObject(apiVersion, kind, namespace, name string) *metav1.PartialObjectMetadata {
+	return &metav1.PartialObjectMetadata{
+		TypeMeta:   metav1.TypeMeta{APIVersion: apiVersion, Kind: kind},
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, UID: types.UID(generateDesignateID())},
+	}
+}
+
+// newFakeKubernetesObjects serves the metadata of the given objects for looking up their UIDs
+func newFakeKubernetesObjects(t *testing.T, objects ...runtime.Object) metadata.Interface {
+	t.Helper()
+	s := runtime.NewScheme()
+	if err := metav1.AddMetaToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	return metadatafake.NewSimpleMetadataClient(s, objects...)
+}
+
+func TestDesignateDetectDrift(t *testing.T) {
+	client := newFakeDesignateClient()
+	ctx := context.TODO()
+
+	zoneID := client.AddZone(ctx, zones.Zone{
+		Name:   "drift.example.",
+		Type:   "PRIMARY",
+		Status: "ACTIVE",
+	})
+	recorder := record.NewFakeRecorder(10)
+	objects := newFakeKubernetesObjects(t,
+		partialObject("networking.k8s.io/v1", "Ingress", "default", "web"),
+		partialObject("v1", "Pod", "dns", "webhook"))
+	p := &designateProvider{client: client, drift: &driftState{expected: map[string]*expectedRecordSet{}},
+		events: events.NewRecorderFor(recorder, objects, "pod/dns/webhook")}
+	defer p.events.Close()
+
+	creates := []*endpoint.Endpoint{
+		{DNSName: "www.drift.example", RecordType: endpoint.RecordTypeA, RecordTTL: 300, Targets: endpoint.Targets{"10.1.1.1"},
+			Labels: map[string]string{endpoint.ResourceLabelKey: "ingress/default/web"}},
+		{DNSName: "ftp.drift.example", RecordType: endpoint.RecordTypeA, Targets: endpoint.Targets{"10.1.1.2"}, Labels: map[string]string{}},
+		{DNSName: "old.drift.example", RecordType: endpoint.RecordTypeA, Targets: endpoint.Targets{"10.1.1.3"}, Labels: map[string]string{}},
+	}
+	if err := p.ApplyChanges(ctx, &plan.Changes{Create: creates}); err != nil {
+		t.Fatal(err)
+	}
+	drifts, err := p.DetectDrift(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 {
+		t.Fatalf("got drift %v right after applying changes", drifts)
+	}
+	current, err := p.Records(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ep := range current {
+		if ep.DNSName == "old.drift.example" {
+			if err := p.ApplyChanges(ctx, &plan.Changes{Delete: []*endpoint.Endpoint{ep}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	p.events.Flush()
+	for len(recorder.Events) > 0 {
+		<-recorder.Events
+	}
+
+	// out-of-band changes
+	for id, rs := range client.managedZones[zoneID].recordSets {
+		switch rs.Name {
+		case "www.drift.example.":
+			client.UpdateRecordSet(ctx, zoneID, id, recordsets.UpdateOpts{Records: []string{"10.9.9.9"}})
+		case "ftp.drift.example.":
+			client.DeleteRecordSet(ctx, zoneID, id)
+		}
+	}
+	client.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{Name: "old.drift.example.", Type: endpoint.RecordTypeA, Records: []string{"10.1.1.3"}})
+
+	detected := testutil.ToFloat64(metrics.DriftDetectedTotal.WithLabelValues(DriftModified))
+	drifts, err = p.DetectDrift(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kinds []string
+	for _, d := range drifts {
+		kinds = append(kinds, d.Name+" "+d.Kind)
+	}
+	want := []string{"ftp.drift.example. deleted", "old.drift.example. recreated", "www.drift.example. modified"}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Errorf("got drift %v, want %v", kinds, want)
+	}
+	if got := testutil.ToFloat64(metrics.DriftedRecordSets); got != 3 {
+		t.Errorf("got %v drifted recordsets, expected 3", got)
+	}
+	if got := testutil.ToFloat64(metrics.DriftDetectedTotal.WithLabelValues(DriftModified)) - detected; got != 1 {
+		t.Errorf("got %v modifications counted, expected 1", got)
+	}
+	p.events.Flush()
+	if len(recorder.Events) != 3 {
+		t.Errorf("got %d events, expected 3", len(recorder.Events))
+	}
+
+	// drift is reported only once
+	if _, err := p.DetectDrift(ctx); err != nil {
+		t.Fatal(err)
+	}
+	p.events.Flush()
+	if len(recorder.Events) != 3 {
+		t.Errorf("got %d events after the second detection, expected 3", len(recorder.Events))
+	}
+
+	// a deletion confirmed by a check is forgotten
+	for id, rs := range client.managedZones[zoneID].recordSets {
+		if rs.Name == "old.drift.example." {
+			client.DeleteRecordSet(ctx, zoneID, id)
+		}
+	}
+	if _, err := p.DetectDrift(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.drift.expected[driftKey(zoneID, "old.drift.example", endpoint.RecordTypeA)]; ok || len(p.drift.expected) != 2 {
+		t.Errorf("deleted recordset is still remembered: %v", slices.Collect(maps.Keys(p.drift.expected)))
+	}
+}
+
+func TestDesignateChangeEvents(t *testing.T) {
+	client := newFakeDesignateClient()
+	ctx := context.TODO()
+
+	zoneID := client.AddZone(ctx, zones.Zone{
+		Name:   "events.example.",
+		Type:   "PRIMARY",
+		Status: "ACTIVE",
+	})
+	updateID, _ := client.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{Name: "api.events.example.", Type: endpoint.RecordTypeA, Records: []string{"10.1.1.1"}})
+	deleteID, _ := client.CreateRecordSet(ctx, zoneID, recordsets.CreateOpts{Name: "old.events.example.", Type: endpoint.RecordTypeA, Records: []string{"10.1.1.2"}})
+
+	recorder := record.NewFakeRecorder(10)
+	recorder.IncludeObject = true
+	objects := newFakeKubernetesObjects(t,
+		partialObject("networking.k8s.io/v1", "Ingress", "default", "web"),
+		partialObject("v1", "Service", "default", "api"),
+		partialObject("externaldns.k8s.io/v1alpha1", "DNSEndpoint", "dns", "old"),
+		partialObject("v1", "Pod", "dns", "webhook"))
+	p := &designateProvider{client: client, events: events.NewRecorderFor(recorder, objects, "pod/dns/webhook")}
+	defer p.events.Close()
+
+	changes := &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			{DNSName: "www.events.example", RecordType: endpoint.RecordTypeA, Targets: endpoint.Targets{"10.1.1.3", "10.1.1.4"},
+				Labels: map[string]string{endpoint.ResourceLabelKey: "ingress/default/web"}},
+		},
+		UpdateOld: []*endpoint.Endpoint{
+			{DNSName: "api.events.example", RecordType: endpoint.RecordTypeA, Targets: endpoint.Targets{"10.1.1.1"},
+				Labels: map[string]string{designateZoneID: zoneID, designateRecordSetID: updateID, designateOriginalRecords: "10.1.1.1"}},
+		},
+		UpdateNew: []*endpoint.Endpoint{
+			{DNSName: "api.events.example", RecordType: endpoint.RecordTypeA, Targets: endpoint.Targets{"10.1.1.5"},
+				Labels: map[string]string{designateZoneID: zoneID, designateRecordSetID: updateID, endpoint.ResourceLabelKey: "service/default/api"}},
+		},
+		Delete: []*endpoint.Endpoint{
+			{DNSName: "old.events.example", RecordType: endpoint.RecordTypeA, Targets: endpoint.Targets{"10.1.1.2"},
+				Labels: map[string]string{designateZoneID: zoneID, designateRecordSetID: deleteID, endpoint.ResourceLabelKey: "crd/dns/old"}},
+			{DNSName: "gone.events.example", RecordType: endpoint.RecordTypeA, Targets: endpoint.Targets{"10.1.1.6"},
+				Labels: map[string]string{designateZoneID: "unknown", designateRecordSetID: "unknown"}},
+		},
+	}
+	if err := p.ApplyChanges(ctx, changes); err == nil {
+		t.Fatal("expected deleting an unknown recordset to fail")
+	}
+
+	p.events.Flush()
+	var got []string
+	for len(recorder.Events) > 0 {
+		got = append(got, <-recorder.Events)
+	}
+	sort.Strings(got)
+	want := []string{
+		"Normal DNSRecordCreated Created www.events.example./A in Designate: 10.1.1.3,10.1.1.4 involvedObject{kind=Ingress,apiVersion=networking.k8s.io/v1}",
+		"Normal DNSRecordDeleted Deleted old.events.example./A in Designate involvedObject{kind=DNSEndpoint,apiVersion=externaldns.k8s.io/v1alpha1}",
+		"Normal DNSRecordUpdated Updated api.events.example./A in Designate: 10.1.1.5 involvedObject{kind=Service,apiVersion=v1}",
+		"Warning DNSRecordFailed Failed to delete gone.events.example./A in Designate: unknown zone unknown involvedObject{kind=Pod,apiVersion=v1}",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got events\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDesignateNotifications(t *testing.T) {
+	client := newFakeDesignateClient()
+	ctx := context.TODO()
+
+	client.AddZone(ctx, zones.Zone{
+		Name:   "notify.example.",
+		Type:   "PRIMARY",
+		Status: "ACTIVE",
+	})
+	bodies := make(chan []byte, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := new(bytes.Buffer)
+		body.ReadFrom(r.Body)
+		bodies <- body.Bytes()
+	}))
+	defer server.Close()
+	notifier, err := notify.New(notify.Config{URL: server.URL, Preset: notify.PresetJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &designateProvider{client: client, notifier: notifier}
+	changes := &plan.Changes{Create: []*endpoint.Endpoint{
+		{DNSName: "www.notify.example", RecordType: endpoint.RecordTypeA, Targets: endpoint.Targets{"10.1.1.1"}, Labels: map[string]string{}},
+		{DNSName: "www.unmatched.example", RecordType: endpoint.RecordTypeA, Targets: endpoint.Targets{"10.1.1.2"}, Labels: map[string]string{}},
+	}}
+	if err := p.ApplyChanges(ctx, changes); err != nil {
+		t.Fatal(err)
+	}
+	dryRun := &designateProvider{client: client, notifier: notifier, dryRun: true}
+	if err := dryRun.ApplyChanges(ctx, changes); err != nil {
+		t.Fatal(err)
+	}
+	if err := notifier.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	close(bodies)
+
+	var summaries []notify.Summary
+	for body := range bodies {
+		var summary notify.Summary
+		if err := json.Unmarshal(body, &summary); err != nil {
+			t.Fatal(err)
+		}
+		summaries = append(summaries, summary)
+	}
+	if len(summaries) != 1 {
+		t.Fatalf("got %d notifications, expected 1", len(summaries))
+	}
+	want := []notify.Change{{Name: "www.notify.example.", Type: endpoint.RecordTypeA, Records: []string{"10.1.1.1"}}}
+	if !reflect.DeepEqual(summaries[0].Created, want) || len(summaries[0].Failed) != 0 {
+		t.Errorf("unexpected summary %+v", summaries[0])
+	}
+}
+
+func TestDesignateApplyChangesWithSummary(t *testing.T) {
+	client := newFakeDesignateClient()
+	ctx := context.TODO()
+
+	zoneID := client.AddZone(ctx, zones.Zone{
+		Name:   "summary.example.",
+		Type:   "PRIMARY",
+		Status: "ACTIVE",
+	})
+	p := &designateProvider{client: client, dryRun: true}
+	changes := &plan.Changes{Create: []*endpoint.Endpoint{
+		{DNSName: "www.summary.example", RecordType: endpoint.RecordTypeA, Targets: endpoint.Targets{"10.1.1.1"}, Labels: map[string]string{}},
+		{DNSName: "www.unmatched.example", RecordType: endpoint.RecordTypeA, Targets: endpoint.Targets{"10.1.1.2"}, Labels: map[string]string{}},
+	}}
+	summary, err := p.ApplyChangesWithSummary(ctx, changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []notify.Change{{Name: "www.summary.example.", Type: endpoint.RecordTypeA, Records: []string{"10.1.1.1"}}}
+	if !reflect.DeepEqual(summary.Created, want) || len(summary.Updated)+len(summary.Deleted)+len(summary.Failed) != 0 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+	if len(client.managedZones[zoneID].recordSets) != 0 {
+		t.Error("dry-run changed Designate")
+	}
+}
+
+func TestDesignateProviderFakeServer(t *testing.T) {
+	server := fakeserver.New()
+	defer server.Close()
+	server.PageSize = 2
+	cloudsYAML := filepath.Join(t.TempDir(), "clouds.yaml")
+	if err := server.WriteCloudsYAML(cloudsYAML); err != nil {
+		t.Fatal(err)
+	}
+	zoneID := server.AddZone("example.com.")
+	server.AddZone("other.org.")
+	server.AddRecordSet(zoneID, "api.example.com.", endpoint.RecordTypeA, 300, "10.0.0.1")
+	server.AddRecordSet(zoneID, "old.example.com.", endpoint.RecordTypeCNAME, 0, "api.example.com.")
+
+	p, err := NewDesignateProvider(*endpoint.NewDomainFilter([]string{"example.com"}), false,
+		client.Config{Cloud: fakeserver.CloudName, CloudsYAML: cloudsYAML})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	current, err := p.Records(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]*endpoint.Endpoint{}
+	for _, ep := range current {
+		byName[ep.DNSName] = ep
+	}
+	if len(current) != 2 || byName["api.example.com"] == nil || byName["old.example.com"] == nil {
+		t.Fatalf("unexpected records %v", current)
+	}
+
+	updated := byName["api.example.com"].DeepCopy()
+	updated.Targets = endpoint.Targets{"10.0.0.2"}
+	changes := &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			{DNSName: "www.example.com", RecordType: endpoint.RecordTypeA, RecordTTL: 60, Targets: endpoint.Targets{"10.0.0.3", "10.0.0.4"}, Labels: map[string]string{}},
+		},
+		UpdateOld: []*endpoint.Endpoint{byName["api.example.com"]},
+		UpdateNew: []*endpoint.Endpoint{updated},
+		Delete:    []*endpoint.Endpoint{byName["old.example.com"]},
+	}
+	if err := p.ApplyChanges(ctx, changes); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	var soa int
+	for _, rs := range server.RecordSets(zoneID) {
+		if rs.Type == "SOA" {
+			soa++
+			continue
+		}
+		records := slices.Clone(rs.Records)
+		sort.Strings(records)
+		got = append(got, fmt.Sprintf("%s %s %d %s %q", rs.Name, rs.Type, rs.TTL, strings.Join(records, ","), rs.Description))
+	}
+	want := []string{
+		`api.example.com. A 300 10.0.0.2 ""`,
+		`example.com. NS 3600 ns1.fake.test.,ns2.fake.test. ""`,
+		`www.example.com. A 60 10.0.0.3,10.0.0.4 ""`,
+	}
+	sort.Strings(got)
+	if soa != 1 || !reflect.DeepEqual(got, want) {
+		t.Errorf("got recordsets\n%s\nwant (besides SOA)\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// aggregationInput drives the generation of recordsets and changes, by the property test and the fuzz target
+type aggregationInput []byte
+
+// intn consumes a byte of the input, returning 0 once it is exhausted
+func (in *aggregationInput) intn(n int) int {
+	if len(*in) == 0 {
+		return 0
+	}
+	b := (*in)[0]
+	*in = (*in)[1:]
+	return int(b) % n
+}
+
+// subset picks a non-empty subset of values
+func (in *aggregationInput) subset(values []string) []string {
+	var picked []string
+	for _, v := range values {
+		if in.intn(2) == 1 {
+			picked = append(picked, v)
+		}
+	}
+	if len(picked) == 0 {
+		picked = []string{values[in.intn(len(values))]}
+	}
+	return picked
+}
+
+// few names and targets, so that changes of different recordsets share targets
+var (
+	aggregationNames   = []string{"a.example.com", "b.example.com", "c.example.com"}
+	aggregationTargets = map[string][]string{
+		endpoint.RecordTypeA:   {"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"},
+		endpoint.RecordTypeTXT: {"one", "two", "three", "four"},
+	}
+)
+
+// appendMissing appends target unless targets already holds it
+func appendMissing(targets endpoint.Targets, target string) endpoint.Targets {
+	if slices.Contains(targets, target) {
+		return targets
+	}
+	return append(targets, target)
+}
+
+// checkAggregation seeds a zone with recordsets, applies changes to them and compares the outcome with a model:
+// every recordset holds its existing records minus the targets updated from or deleted, plus the targets created
+// or updated to, and recordsets left without records are deleted. A create of an existing recordset replaces its
+// records, as the TXT registry creates records it found no ownership for. Recordsets keep their IDs unless deleted.
+func checkAggregation(in aggregationInput) error {
+	ctx := context.Background()
+	client := newFakeDesignateClient()
+	client.AddZone(ctx, zones.Zone{ID: "zone-1", Name: "example.com.", Type: "PRIMARY", Status: "ACTIVE"})
+
+	type key struct{ name, recordType string }
+	var keys []key
+	for _, name := range aggregationNames {
+		keys = append(keys, key{name, endpoint.RecordTypeA}, key{name, endpoint.RecordTypeTXT})
+	}
+	expected := map[key]map[string]bool{}
+	ids := map[key]string{}
+	for _, k := range keys {
+		expected[k] = map[string]bool{}
+		if in.intn(2) == 0 {
+			continue
+		}
+		records := in.subset(aggregationTargets[k.recordType])
+		id, _ := client.CreateRecordSet(ctx, "zone-1", recordsets.CreateOpts{Name: k.name + ".", Type: k.recordType, Records: records, TTL: 300})
+		ids[k] = id
+		for _, r := range records {
+			expected[k][r] = true
+		}
+	}
+
+	p := client.ToProvider()
+	current, err := p.Records(ctx)
+	if err != nil {
+		return err
+	}
+	existing := map[key]*endpoint.Endpoint{}
+	for _, ep := range current {
+		existing[key{ep.DNSName, ep.RecordType}] = ep
+	}
+
+	changes := &plan.Changes{}
+	for _, k := range keys {
+		ep := existing[k]
+		op := in.intn(7)
+		switch {
+		case op == 0:
+		case op == 1 || ep == nil:
+			// creates of existing recordsets lack the Designate labels, like those of the TXT registry
+			create := endpoint.NewEndpointWithTTL(k.name, k.recordType, 300, in.subset(aggregationTargets[k.recordType])...)
+			changes.Create = append(changes.Create, create)
+			expected[k] = map[string]bool{}
+			for _, t := range create.Targets {
+				expected[k][t] = true
+			}
+		case op == 2:
+			old := ep.DeepCopy()
+			old.Targets = in.subset(ep.Targets)
+			updated := old.DeepCopy()
+			updated.Targets = in.subset(aggregationTargets[k.recordType])
+			if in.intn(2) == 0 {
+				updated.Labels = endpoint.NewLabels()
+			}
+			changes.UpdateOld = append(changes.UpdateOld, old)
+			changes.UpdateNew = append(changes.UpdateNew, updated)
+			for _, t := range old.Targets {
+				delete(expected[k], t)
+			}
+			for _, t := range updated.Targets {
+				expected[k][t] = true
+			}
+		case op == 3:
+			deleted := ep.DeepCopy()
+			deleted.Targets = in.subset(ep.Targets)
+			changes.Delete = append(changes.Delete, deleted)
+			for _, t := range deleted.Targets {
+				delete(expected[k], t)
+			}
+		case op == 4:
+			changes.Delete = append(changes.Delete, ep.DeepCopy())
+			expected[k] = map[string]bool{}
+		case op == 5:
+			// a target deleted and created again, e.g. moved between owners, stays
+			deleted := ep.DeepCopy()
+			deleted.Targets = in.subset(ep.Targets)
+			create := endpoint.NewEndpointWithTTL(k.name, k.recordType, 300, in.subset(aggregationTargets[k.recordType])...)
+			create.Targets = appendMissing(create.Targets, deleted.Targets[in.intn(len(deleted.Targets))])
+			changes.Delete = append(changes.Delete, deleted)
+			changes.Create = append(changes.Create, create)
+			for _, t := range deleted.Targets {
+				delete(expected[k], t)
+			}
+			for _, t := range create.Targets {
+				expected[k][t] = true
+			}
+		default:
+			// a target deleted or updated from, and updated to, stays
+			old := ep.DeepCopy()
+			old.Targets = in.subset(ep.Targets)
+			deleted := ep.DeepCopy()
+			deleted.Targets = in.subset(ep.Targets)
+			updated := old.DeepCopy()
+			updated.Targets = in.subset(aggregationTargets[k.recordType])
+			removed := append(slices.Clone(old.Targets), deleted.Targets...)
+			updated.Targets = appendMissing(updated.Targets, removed[in.intn(len(removed))])
+			changes.UpdateOld = append(changes.UpdateOld, old)
+			changes.UpdateNew = append(changes.UpdateNew, updated)
+			changes.Delete = append(changes.Delete, deleted)
+			for _, t := range removed {
+				delete(expected[k], t)
+			}
+			for _, t := range updated.Targets {
+				expected[k][t] = true
+			}
+		}
+	}
+
+	if err := p.ApplyChanges(ctx, changes); err != nil {
+		return fmt.Errorf("failed to apply changes: %w", err)
+	}
+
+	actual := map[key]*recordsets.RecordSet{}
+	for _, rs := range client.managedZones["zone-1"].recordSets {
+		actual[key{strings.TrimSuffix(rs.Name, "."), rs.Type}] = rs
+	}
+	for _, k := range keys {
+		want := sortedRecords(slices.Collect(maps.Keys(expected[k])))
+		rs := actual[k]
+		switch {
+		case rs == nil && len(want) > 0:
+			return fmt.Errorf("%s/%s: missing, want %v", k.name, k.recordType, want)
+		case rs == nil:
+		case len(want) == 0:
+			return fmt.Errorf("%s/%s: got %v, want no recordset", k.name, k.recordType, rs.Records)
+		case !slices.Equal(sortedRecords(rs.Records), want):
+			return fmt.Errorf("%s/%s: got %v, want %v", k.name, k.recordType, sortedRecords(rs.Records), want)
+		case ids[k] != "" && rs.ID != ids[k]:
+			return fmt.Errorf("%s/%s: recordset %s was replaced by %s", k.name, k.recordType, ids[k], rs.ID)
+		}
+	}
+	return nil
+}
+
+func TestAddEndpointKeepsTargets(t *testing.T) {
+	existing := func(name string, records ...string) *endpoint.Endpoint {
+		ep := endpoint.NewEndpoint(name, endpoint.RecordTypeA, records...)
+		ep.Labels[designateZoneID] = "zone-1"
+		ep.Labels[designateRecordSetID] = "id-" + name
+		ep.Labels[designateOriginalRecords] = strings.Join(records, "\000")
+		return ep
+	}
+	www := existing("www.example.com", "10.0.0.1", "10.0.0.2", "10.0.0.3")
+	api := existing("api.example.com", "10.0.0.4")
+	withTargets := func(ep *endpoint.Endpoint, targets ...string) *endpoint.Endpoint {
+		ep = ep.DeepCopy()
+		ep.Targets = targets
+		return ep
+	}
+
+	for _, tc := range []struct {
+		name    string
+		changes plan.Changes
+		want    map[string][]string
+	}{
+		{
+			name: "update keeping a target",
+			changes: plan.Changes{
+				UpdateOld: []*endpoint.Endpoint{withTargets(www, "10.0.0.1", "10.0.0.2")},
+				UpdateNew: []*endpoint.Endpoint{withTargets(www, "10.0.0.2", "10.0.0.5")},
+			},
+			want: map[string][]string{"www.example.com/A": {"10.0.0.2", "10.0.0.3", "10.0.0.5"}},
+		},
+		{
+			name: "target moved to another recordset",
+			changes: plan.Changes{
+				Create: []*endpoint.Endpoint{endpoint.NewEndpoint("new.example.com", endpoint.RecordTypeA, "10.0.0.1")},
+				Delete: []*endpoint.Endpoint{withTargets(www, "10.0.0.1")},
+			},
+			want: map[string][]string{
+				"new.example.com/A": {"10.0.0.1"},
+				"www.example.com/A": {"10.0.0.2", "10.0.0.3"},
+			},
+		},
+		{
+			name: "target deleted and created again",
+			changes: plan.Changes{
+				Create: []*endpoint.Endpoint{withTargets(www, "10.0.0.1", "10.0.0.5")},
+				Delete: []*endpoint.Endpoint{withTargets(www, "10.0.0.1", "10.0.0.2")},
+			},
+			want: map[string][]string{"www.example.com/A": {"10.0.0.1", "10.0.0.3", "10.0.0.5"}},
+		},
+		{
+			name: "target swapped between recordsets",
+			changes: plan.Changes{
+				UpdateOld: []*endpoint.Endpoint{withTargets(www, "10.0.0.3"), api},
+				UpdateNew: []*endpoint.Endpoint{withTargets(www, "10.0.0.4"), withTargets(api, "10.0.0.3")},
+			},
+			want: map[string][]string{
+				"api.example.com/A": {"10.0.0.3"},
+				"www.example.com/A": {"10.0.0.1", "10.0.0.2", "10.0.0.4"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			current := []*endpoint.Endpoint{www, api}
+			recordSets := map[string]*recordSet{}
+			for _, ep := range tc.changes.UpdateOld {
+				addEndpoint(ep, recordSets, current, true)
+			}
+			for _, ep := range tc.changes.Delete {
+				addEndpoint(ep, recordSets, current, true)
+			}
+			for _, ep := range tc.changes.Create {
+				addEndpoint(ep, recordSets, current, false)
+			}
+			for _, ep := range tc.changes.UpdateNew {
+				addEndpoint(ep, recordSets, current, false)
+			}
+			got := map[string][]string{}
+			for key, rs := range recordSets {
+				got[key] = sortedRecords(rs.records())
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDesignateApplyChangesProperties(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	for range 2000 {
+		in := make([]byte, 96)
+		for i := range in {
+			in[i] = byte(r.UintN(256))
+		}
+		if err := checkAggregation(in); err != nil {
+			t.Fatalf("input %x: %v", in, err)
+		}
+	}
+}
+
+func FuzzDesignateApplyChanges(f *testing.F) {
+	// few existing recordsets, and all recordsets existing and changed
+	f.Add([]byte{1, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 1, 0, 0, 0, 1, 1, 0, 0, 0, 3, 1, 0, 0, 0})
+	f.Add([]byte{1, 1, 0, 1, 0, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 1, 1, 1, 1, 1, 1, 1, 1})
+	f.Fuzz(func(t *testing.T, in []byte) {
+		if err := checkAggregation(in); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// chaosState returns the sorted records of the recordsets in zone-1 by name and type
+func chaosState(c *fakeDesignateClient) map[string][]string {
+	state := map[string][]string{}
+	for _, rs := range c.managedZones["zone-1"].recordSets {
+		state[rs.Name+"/"+rs.Type] = sortedRecords(rs.Records)
+	}
+	return state
+}
+
+// chaosChanges plans the changes turning the current endpoints into the desired recordsets
+func chaosChanges(current []*endpoint.Endpoint, desired map[string][]string) *plan.Changes {
+	changes := &plan.Changes{}
+	seen := map[string]bool{}
+	for _, ep := range current {
+		key := canonicalizeDomainName(ep.DNSName) + "/" + ep.RecordType
+		seen[key] = true
+		want, ok := desired[key]
+		switch {
+		case !ok:
+			changes.Delete = append(changes.Delete, ep)
+		case !slices.Equal(sortedRecords(ep.Targets), want):
+			updated := ep.DeepCopy()
+			updated.Targets = want
+			changes.UpdateOld = append(changes.UpdateOld, ep)
+			changes.UpdateNew = append(changes.UpdateNew, updated)
+		}
+	}
+	for key, want := range desired {
+		if !seen[key] {
+			name, recordType, _ := strings.Cut(key, "/")
+			changes.Create = append(changes.Create, endpoint.NewEndpoint(strings.TrimSuffix(name, "."), recordType, want...))
+		}
+	}
+	return changes
+}
+
+// injectedFaults sums the faults injected into all methods
+func injectedFaults() float64 {
+	var sum float64
+	for _, method := range []string{"ForEachZone", "ForEachRecordSet", "CreateRecordSet", "UpdateRecordSet", "DeleteRecordSet"} {
+		for _, fault := range []string{"error", "conflict", "pagination"} {
+			sum += testutil.ToFloat64(metrics.InjectedFaultsTotal.WithLabelValues(method, fault))
+		}
+	}
+	return sum
+}
+
+func TestDesignateChaos(t *testing.T) {
+	ctx := context.Background()
+	for _, transactional := range []bool{false, true} {
+		for seed := range uint64(10) {
+			fake := newFakeDesignateClient()
+			fake.AddZone(ctx, zones.Zone{ID: "zone-1", Name: "example.com.", Type: "PRIMARY", Status: "ACTIVE"})
+			desired := map[string][]string{}
+			for i := range 15 {
+				name := fmt.Sprintf("host%d.example.com.", i)
+				if i < 10 {
+					_, _ = fake.CreateRecordSet(ctx, "zone-1", recordsets.CreateOpts{Name: name, Type: endpoint.RecordTypeA, Records: []string{fmt.Sprintf("10.0.0.%d", i)}})
+				}
+				switch {
+				case i >= 10:
+					desired[name+"/A"] = []string{fmt.Sprintf("10.2.0.%d", i)}
+				case i%3 == 1:
+					desired[name+"/A"] = []string{fmt.Sprintf("10.0.0.%d", i), fmt.Sprintf("10.1.0.%d", i)}
+				case i%3 == 2:
+					desired[name+"/A"] = []string{fmt.Sprintf("10.0.0.%d", i)}
+				}
+			}
+			p := &designateProvider{
+				client: client.NewFaultInjectingClient(fake, client.FaultConfig{
+					ErrorRates:            map[string]float64{"": 0.05},
+					ConflictRate:          0.2,
+					PaginationFailureRate: 0.2,
+					Seed:                  seed + 1,
+				}),
+				transactional: transactional,
+			}
+
+			for range 30 {
+				current, err := p.Records(ctx)
+				if err != nil {
+					continue
+				}
+				changes := chaosChanges(current, desired)
+				if !changes.HasChanges() {
+					break
+				}
+				before, faults := chaosState(fake), injectedFaults()
+				err = p.ApplyChanges(ctx, changes)
+				if injected := injectedFaults() - faults; (injected > 0) != (err != nil) {
+					t.Fatalf("transactional=%v seed %d: ApplyChanges returned %v after %v injected faults", transactional, seed, err, injected)
+				}
+				after := chaosState(fake)
+				for key, records := range after {
+					if !slices.Equal(records, before[key]) && !slices.Equal(records, desired[key]) {
+						t.Fatalf("transactional=%v seed %d: recordset %s holds %v, neither %v before nor %v desired", transactional, seed, key, records, before[key], desired[key])
+					}
+				}
+				for key := range before {
+					if _, ok := after[key]; !ok && desired[key] != nil {
+						t.Fatalf("transactional=%v seed %d: desired recordset %s was deleted", transactional, seed, key)
+					}
+				}
+			}
+
+			// once Designate recovers, a single reconciliation reaches the desired state
+			p.client = fake
+			current, err := p.Records(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := p.ApplyChanges(ctx, chaosChanges(current, desired)); err != nil {
+				t.Fatalf("transactional=%v seed %d: %v", transactional, seed, err)
+			}
+			if state := chaosState(fake); !reflect.DeepEqual(state, desired) {
+				t.Errorf("transactional=%v seed %d: got %v, want %v", transactional, seed, state, desired)
+			}
+		}
+	}
+}
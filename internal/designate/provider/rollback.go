@@ -0,0 +1,144 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/dns/v2/recordsets"
+	log "github.com/sirupsen/logrus"
+
+	"external-dns-openstack-webhook/internal/audit"
+	"external-dns-openstack-webhook/internal/metrics"
+	"external-dns-openstack-webhook/internal/notify"
+)
+
+// errUnknownOriginalRecords prevents a rollback from writing a recordset without records
+var errUnknownOriginalRecords = errors.New("original records are unknown")
+
+// a change that was successfully applied to Designate during ApplyChanges
+type appliedChange struct {
+	rs     *recordSet
+	action string
+}
+
+// rollback reverts the applied changes in reverse order after cause made ApplyChanges fail.
+// The returned error wraps cause and describes the outcome of the rollback.
+// Reverted changes are added to summary.
+func (p designateProvider) rollback(ctx context.Context, applied []appliedChange, managedZones map[string]string, summary *notify.Summary, cause error) error {
+	if len(applied) == 0 {
+		return cause
+	}
+	log.Warnf("Rolling back %d applied changes after error: %v", len(applied), cause)
+
+	var failures []error
+	for i := len(applied) - 1; i >= 0; i-- {
+		if err := p.revertChange(ctx, applied[i], managedZones, summary); err != nil {
+			rs := applied[i].rs
+			log.Errorf("Failed to roll back %s of %s/%s: %v", applied[i].action, rs.dnsName, rs.recordType, err)
+			failures = append(failures, fmt.Errorf("%s/%s: %w", rs.dnsName, rs.recordType, err))
+		}
+	}
+
+	if len(failures) == 0 {
+		metrics.RollbacksTotal.WithLabelValues("success").Inc()
+		log.Infof("Rolled back all %d applied changes", len(applied))
+		return fmt.Errorf("%w (rolled back %d applied changes)", cause, len(applied))
+	}
+	metrics.RollbacksTotal.WithLabelValues("partial").Inc()
+	return fmt.Errorf("%w (rolled back %d of %d applied changes, rollback failed for: %w)",
+		cause, len(applied)-len(failures), len(applied), errors.Join(failures...))
+}
+
+// revertChange restores the state of a single recordset from before the change, adding the outcome to summary
+func (p designateProvider) revertChange(ctx context.Context, change appliedChange, managedZones map[string]string, summary *notify.Summary) error {
+	rs := change.rs
+	startTime := time.Now()
+	var action string
+	var records []string
+	var err error
+
+	switch change.action {
+	case audit.ActionCreate:
+		action = audit.ActionDelete
+		log.Infof("Rolling back creation of %s/%s", rs.dnsName, rs.recordType)
+		err = p.client.DeleteRecordSet(ctx, rs.zoneID, rs.recordSetID)
+	case audit.ActionUpdate:
+		action = audit.ActionUpdate
+		records = rs.originalRecords
+		if len(records) == 0 {
+			err = errUnknownOriginalRecords
+			break
+		}
+		log.Infof("Rolling back update of %s/%s: %s", rs.dnsName, rs.recordType, strings.Join(records, ","))
+		ttl := rs.originalTTL
+		err = p.client.UpdateRecordSet(ctx, rs.zoneID, rs.recordSetID, recordsets.UpdateOpts{
+			Records: records,
+			TTL:     &ttl,
+		})
+	case audit.ActionDelete:
+		action = audit.ActionCreate
+		records = rs.originalRecords
+		if len(records) == 0 {
+			err = errUnknownOriginalRecords
+			break
+		}
+		log.Infof("Rolling back deletion of %s/%s: %s", rs.dnsName, rs.recordType, strings.Join(records, ","))
+		rs.recordSetID, err = p.client.CreateRecordSet(ctx, rs.zoneID, recordsets.CreateOpts{
+			Name:        rs.dnsName,
+			Type:        rs.recordType,
+			Records:     records,
+			TTL:         rs.originalTTL,
+			Description: rs.originalDescription,
+		})
+	default:
+		return fmt.Errorf("unknown action %q", change.action)
+	}
+	if err == nil {
+		p.drift.recordWrite(rs, action, rs.originalTTL, records)
+	}
+	p.emitChangeEvent(rs, action, records, err)
+	summary.AddRollback(change.action, rs.dnsName, rs.recordType, records, err)
+
+	if p.auditLogger != nil {
+		entry := audit.Entry{
+			Timestamp:   time.Now(),
+			Action:      action,
+			ZoneID:      rs.zoneID,
+			Zone:        managedZones[rs.zoneID],
+			Name:        rs.dnsName,
+			Type:        rs.recordType,
+			RecordSetID: rs.recordSetID,
+			OldRecords:  rs.records(),
+			NewRecords:  records,
+			TTL:         rs.originalTTL,
+			Result:      audit.ResultSuccess,
+			Rollback:    true,
+			Duration:    time.Since(startTime).Seconds(),
+		}
+		if err != nil {
+			entry.Result = audit.ResultFailure
+			entry.Error = err.Error()
+		}
+		p.auditLogger.Log(entry)
+	}
+	return err
+}
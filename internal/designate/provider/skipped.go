@@ -0,0 +1,116 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"external-dns-openstack-webhook/internal/metrics"
+)
+
+// reasons for skipping a record, used as metric label
+const (
+	skipReasonNoZone            = "no_zone"
+	skipReasonProtected         = "protected"
+	skipReasonNotOwned          = "not_owned"
+	skipReasonDeletionThreshold = "deletion_threshold"
+)
+
+// UnmatchedRecord is a record that was skipped because no managed zone matches its name
+type UnmatchedRecord struct {
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Count     int       `json:"count"`
+}
+
+// UnmatchedRecords keeps track of the records currently skipped for lack of a matching zone.
+// A record is forgotten as soon as it could be matched to a zone. A nil *UnmatchedRecords tracks nothing.
+type UnmatchedRecords struct {
+	mu      sync.Mutex
+	records map[string]*UnmatchedRecord
+}
+
+// NewUnmatchedRecords creates an empty UnmatchedRecords tracker
+func NewUnmatchedRecords() *UnmatchedRecords {
+	return &UnmatchedRecords{records: map[string]*UnmatchedRecord{}}
+}
+
+// add remembers a record without matching zone
+func (u *UnmatchedRecords) add(name, recordType string) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := time.Now()
+	key := name + "/" + recordType
+	r := u.records[key]
+	if r == nil {
+		r = &UnmatchedRecord{Name: name, Type: recordType, FirstSeen: now}
+		u.records[key] = r
+	}
+	r.LastSeen = now
+	r.Count++
+}
+
+// remove forgets a record, e.g. because a zone for it exists now
+func (u *UnmatchedRecords) remove(name, recordType string) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.records, name+"/"+recordType)
+}
+
+// List returns the currently unmatched records ordered by name and type
+func (u *UnmatchedRecords) List() []UnmatchedRecord {
+	result := []UnmatchedRecord{}
+	if u == nil {
+		return result
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, r := range u.records {
+		result = append(result, *r)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].Type < result[j].Type
+	})
+	return result
+}
+
+// ServeHTTP writes the currently unmatched records as JSON
+func (u *UnmatchedRecords) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(u.List())
+}
+
+// skipRecord counts a record that is not applied for the given reason
+func skipRecord(rs *recordSet, reason string) {
+	metrics.SkippedRecordsTotal.WithLabelValues(reason, rs.recordType).Inc()
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"external-dns-openstack-webhook/internal/metrics"
+)
+
+// operations tracked by SyncStatus, used as metric label
+const (
+	operationRecords      = "records"
+	operationApplyChanges = "apply_changes"
+)
+
+// OperationStatus is the outcome history of an operation called by external-dns
+type OperationStatus struct {
+	LastSuccess         *time.Time `json:"lastSuccess,omitempty"`
+	LastFailure         *time.Time `json:"lastFailure,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+}
+
+// SyncStatus keeps track of the last successful and failed Records and ApplyChanges calls.
+// A nil *SyncStatus tracks nothing.
+type SyncStatus struct {
+	mu         sync.Mutex
+	operations map[string]*OperationStatus
+}
+
+// NewSyncStatus creates a SyncStatus, which has to be passed to the provider using WithSyncStatus
+func NewSyncStatus() *SyncStatus {
+	return &SyncStatus{operations: map[string]*OperationStatus{
+		operationRecords:      {},
+		operationApplyChanges: {},
+	}}
+}
+
+// record remembers the outcome of an operation and updates the staleness metrics
+func (s *SyncStatus) record(operation string, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	status := s.operations[operation]
+	if err == nil {
+		status.LastSuccess = &now
+		status.ConsecutiveFailures = 0
+		metrics.LastSuccessTimestamp.WithLabelValues(operation).Set(float64(now.Unix()))
+	} else {
+		status.LastFailure = &now
+		status.LastError = err.Error()
+		status.ConsecutiveFailures++
+		metrics.LastFailureTimestamp.WithLabelValues(operation).Set(float64(now.Unix()))
+	}
+	metrics.ConsecutiveFailures.WithLabelValues(operation).Set(float64(status.ConsecutiveFailures))
+}
+
+// Status returns a copy of the current status per operation
+func (s *SyncStatus) Status() map[string]OperationStatus {
+	result := map[string]OperationStatus{}
+	if s == nil {
+		return result
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for operation, status := range s.operations {
+		result[operation] = *status
+	}
+	return result
+}
+
+// ServeHTTP writes the current status as JSON
+func (s *SyncStatus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.Status())
+}
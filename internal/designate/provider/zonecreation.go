@@ -0,0 +1,88 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/dns/v2/zones"
+	log "github.com/sirupsen/logrus"
+
+	"external-dns-openstack-webhook/internal/metrics"
+)
+
+// prefix of the IDs standing in for zones that would be created in dry-run mode
+const dryRunZoneIDPrefix = "dry-run:"
+
+// zoneCreation holds the settings for zones created automatically for unmatched hostnames
+type zoneCreation struct {
+	// parent domains (FQDN) below which zones may be created, disabled if empty
+	parents []string
+	// contact email, TTL and description of created zones
+	email       string
+	ttl         int
+	description string
+}
+
+// zoneNameForHostname returns the name of the zone to create for the hostname, which is the parent domain
+// extended by the label directly below it. Returns "" if the hostname is not below a configured parent.
+func (zc zoneCreation) zoneNameForHostname(hostname string) string {
+	best := ""
+	for _, parent := range zc.parents {
+		if !strings.HasSuffix(hostname, "."+parent) || len(parent) <= len(best) {
+			continue
+		}
+		best = parent
+	}
+	if best == "" {
+		return ""
+	}
+	labels := strings.Split(strings.TrimSuffix(hostname, "."+best), ".")
+	return labels[len(labels)-1] + "." + best
+}
+
+// createZoneForHostname creates the zone for a hostname not matched by any managed zone and adds it to managedZones.
+// Returns the ID of the new zone, or "" if no zone may be created for the hostname. In dry-run mode, a placeholder ID
+// is returned so that the records are previewed as if the zone existed.
+func (p designateProvider) createZoneForHostname(ctx context.Context, hostname string, managedZones map[string]string) (string, error) {
+	zoneName := p.zoneCreation.zoneNameForHostname(hostname)
+	if zoneName == "" || !p.domainFilter.Match(zoneName) {
+		return "", nil
+	}
+
+	log.Infof("Creating zone %s for record %s", zoneName, hostname)
+	if p.dryRun {
+		zoneID := dryRunZoneIDPrefix + zoneName
+		managedZones[zoneID] = zoneName
+		return zoneID, nil
+	}
+	zone, err := p.client.CreateZone(ctx, zones.CreateOpts{
+		Name:        zoneName,
+		Email:       p.zoneCreation.email,
+		TTL:         p.zoneCreation.ttl,
+		Description: p.zoneCreation.description,
+		Type:        "PRIMARY",
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create zone %s for record %s: %w", zoneName, hostname, err)
+	}
+	metrics.ZonesCreatedTotal.Inc()
+	managedZones[zone.ID] = canonicalizeDomainName(zone.Name)
+	return zone.ID, nil
+}
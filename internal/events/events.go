@@ -0,0 +1,303 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package events emits Kubernetes Events about DNS records on the resources they originate from.
+package events
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
+)
+
+// component reported as source of the events
+const component = "external-dns-openstack-webhook"
+
+// event types
+const (
+	TypeNormal  = corev1.EventTypeNormal
+	TypeWarning = corev1.EventTypeWarning
+)
+
+const (
+	// time the UID of an object is cached, objects may be recreated with a new UID
+	uidCacheTTL = 10 * time.Minute
+	// time a failed lookup is cached, so missing objects are not looked up for every event
+	failedLookupTTL = time.Minute
+	// timeout of looking up the UID of an object
+	lookupTimeout = 5 * time.Second
+	// maximum number of events waiting to be emitted, further ones are dropped
+	queueSize = 1000
+)
+
+// resourceKind is the API version, kind and resource name of a kind used in the resource label of external-dns
+type resourceKind struct {
+	apiVersion string
+	kind       string
+	resource   string
+}
+
+// resourceKinds maps the kinds used in the resource label of external-dns sources to their API resources
+var resourceKinds = map[string]resourceKind{
+	"pod":             {"v1", "Pod", "pods"},
+	"service":         {"v1", "Service", "services"},
+	"node":            {"v1", "Node", "nodes"},
+	"ingress":         {"networking.k8s.io/v1", "Ingress", "ingresses"},
+	"crd":             {"externaldns.k8s.io/v1alpha1", "DNSEndpoint", "dnsendpoints"},
+	"httproute":       {"gateway.networking.k8s.io/v1", "HTTPRoute", "httproutes"},
+	"grpcroute":       {"gateway.networking.k8s.io/v1", "GRPCRoute", "grpcroutes"},
+	"tlsroute":        {"gateway.networking.k8s.io/v1alpha2", "TLSRoute", "tlsroutes"},
+	"tcproute":        {"gateway.networking.k8s.io/v1alpha2", "TCPRoute", "tcproutes"},
+	"udproute":        {"gateway.networking.k8s.io/v1alpha2", "UDPRoute", "udproutes"},
+	"gateway":         {"networking.istio.io/v1", "Gateway", "gateways"},
+	"virtualservice":  {"networking.istio.io/v1", "VirtualService", "virtualservices"},
+	"route":           {"route.openshift.io/v1", "Route", "routes"},
+	"ingressroute":    {"traefik.io/v1alpha1", "IngressRoute", "ingressroutes"},
+	"ingressroutetcp": {"traefik.io/v1alpha1", "IngressRouteTCP", "ingressroutetcps"},
+	"ingressrouteudp": {"traefik.io/v1alpha1", "IngressRouteUDP", "ingressrouteudps"},
+	"host":            {"getambassador.io/v3alpha1", "Host", "hosts"},
+	"routegroup":      {"zalando.org/v1", "RouteGroup", "routegroups"},
+}
+
+// ParseObjectReference parses a resource label of external-dns like "ingress/default/web" or "node/worker-1"
+// into an object reference without UID. Kinds unknown to external-dns are rejected.
+func ParseObjectReference(resource string) (*corev1.ObjectReference, error) {
+	ref, _, err := parseResource(resource)
+	return ref, err
+}
+
+// parseResource parses a resource label into an object reference and the API resource of the object
+func parseResource(resource string) (*corev1.ObjectReference, schema.GroupVersionResource, error) {
+	parts := strings.Split(resource, "/")
+	var namespace, name string
+	switch len(parts) {
+	case 2:
+		name = parts[1]
+	case 3:
+		namespace, name = parts[1], parts[2]
+	default:
+		return nil, schema.GroupVersionResource{}, fmt.Errorf("resource %q is not of the form kind/namespace/name", resource)
+	}
+	kind, ok := resourceKinds[strings.ToLower(parts[0])]
+	if !ok {
+		return nil, schema.GroupVersionResource{}, fmt.Errorf("resource %q is of unknown kind %q", resource, parts[0])
+	}
+	if name == "" {
+		return nil, schema.GroupVersionResource{}, fmt.Errorf("resource %q lacks a name", resource)
+	}
+	gv, err := schema.ParseGroupVersion(kind.apiVersion)
+	if err != nil {
+		return nil, schema.GroupVersionResource{}, err
+	}
+	ref := &corev1.ObjectReference{APIVersion: kind.apiVersion, Kind: kind.kind, Namespace: namespace, Name: name}
+	return ref, gv.WithResource(kind.resource), nil
+}
+
+// cachedUID is the UID of an object, or the error looking it up, cached until expires
+type cachedUID struct {
+	uid     types.UID
+	err     error
+	expires time.Time
+}
+
+// queuedEvent is an event waiting to be emitted by the worker, or a flush request if flushed is set
+type queuedEvent struct {
+	resource, eventType, reason, message string
+	flushed                              chan struct{}
+}
+
+// Recorder emits events on the resource an endpoint originates from, or on a fallback object if the resource is
+// unknown or cannot be found. Events carry the UID of their object, which kubectl describe matches them by.
+// Events are emitted in the background, so looking up objects never delays the changes. A nil *Recorder emits nothing.
+type Recorder struct {
+	recorder    record.EventRecorder
+	broadcaster record.EventBroadcaster
+	objects     metadata.Interface
+	fallback    string
+	uids        map[string]cachedUID
+	queue       chan queuedEvent
+	done        chan struct{}
+
+	// guards closing the queue against concurrent Eventf calls
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewRecorder connects to the Kubernetes API using the kubeconfig file, or the in-cluster configuration if empty.
+// fallback is the resource label of the object receiving events about unknown resources.
+func NewRecorder(kubeconfig, fallback string) (*Recorder, error) {
+	var config *rest.Config
+	var err error
+	if kubeconfig != "" {
+		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	} else {
+		config, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Kubernetes configuration: %w", err)
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	objects, err := metadata.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes metadata client: %w", err)
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	r := NewRecorderFor(broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: component}), objects, fallback)
+	r.broadcaster = broadcaster
+	return r, nil
+}
+
+// NewRecorderFor creates a Recorder emitting to the given event recorder and looking up UIDs through objects,
+// e.g. a record.FakeRecorder and a fake metadata client in tests, and starts its worker
+func NewRecorderFor(recorder record.EventRecorder, objects metadata.Interface, fallback string) *Recorder {
+	r := &Recorder{
+		recorder: recorder,
+		objects:  objects,
+		fallback: fallback,
+		uids:     map[string]cachedUID{},
+		queue:    make(chan queuedEvent, queueSize),
+		done:     make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// resolve returns a reference including the UID of the object named by the resource label
+func (r *Recorder) resolve(resource string) (*corev1.ObjectReference, error) {
+	ref, gvr, err := parseResource(resource)
+	if err != nil {
+		return nil, err
+	}
+	key := ref.APIVersion + "/" + ref.Kind + "/" + ref.Namespace + "/" + ref.Name
+	if cached, ok := r.uids[key]; ok && time.Now().Before(cached.expires) {
+		ref.UID = cached.uid
+		return ref, cached.err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+	object, err := r.objects.Resource(gvr).Namespace(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	if err != nil {
+		err = fmt.Errorf("failed to look up %s: %w", resource, err)
+		r.uids[key] = cachedUID{err: err, expires: time.Now().Add(failedLookupTTL)}
+		return ref, err
+	}
+	ref.UID = object.UID
+	r.uids[key] = cachedUID{uid: object.UID, expires: time.Now().Add(uidCacheTTL)}
+	return ref, nil
+}
+
+// Eventf queues an event on the object named by the resource label without blocking
+func (r *Recorder) Eventf(resource, eventType, reason, messageFmt string, args ...any) {
+	if r == nil {
+		return
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		log.Debugf("Dropping event %s because the recorder is closed", reason)
+		return
+	}
+	select {
+	case r.queue <- queuedEvent{resource: resource, eventType: eventType, reason: reason, message: fmt.Sprintf(messageFmt, args...)}:
+	default:
+		log.Warnf("Dropping event %s because %d events are waiting to be emitted", reason, cap(r.queue))
+	}
+}
+
+// Flush waits until the events queued so far are emitted
+func (r *Recorder) Flush() {
+	if r == nil {
+		return
+	}
+	r.mu.RLock()
+	if r.closed {
+		r.mu.RUnlock()
+		return
+	}
+	flushed := make(chan struct{})
+	r.queue <- queuedEvent{flushed: flushed}
+	r.mu.RUnlock()
+	<-flushed
+}
+
+// run emits the queued events until the queue is closed
+func (r *Recorder) run() {
+	defer close(r.done)
+	for e := range r.queue {
+		if e.flushed != nil {
+			close(e.flushed)
+			continue
+		}
+		r.emit(e)
+	}
+}
+
+// emit emits an event on the object named by its resource label, falling back to the fallback object
+func (r *Recorder) emit(e queuedEvent) {
+	object, err := r.resolve(e.resource)
+	if err != nil {
+		if e.resource != "" {
+			log.Debugf("Emitting event on the fallback object: %v", err)
+		}
+		if object, err = r.resolve(r.fallback); err != nil {
+			log.Debugf("Emitting event on the fallback object without UID: %v", err)
+			if object, err = ParseObjectReference(r.fallback); err != nil {
+				log.Warnf("Dropping event %s: %v", e.reason, err)
+				return
+			}
+		}
+	}
+	r.recorder.Event(object, e.eventType, e.reason, e.message)
+}
+
+// Close emits the queued events and flushes them to the Kubernetes API
+func (r *Recorder) Close() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	closing := !r.closed
+	if closing {
+		r.closed = true
+		close(r.queue)
+	}
+	r.mu.Unlock()
+	<-r.done
+	if closing && r.broadcaster != nil {
+		r.broadcaster.Shutdown()
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestParseObjectReference(t *testing.T) {
+	tests := []struct {
+		resource string
+		want     *corev1.ObjectReference
+	}{
+		{"ingress/default/web", &corev1.ObjectReference{APIVersion: "networking.k8s.io/v1", Kind: "Ingress", Namespace: "default", Name: "web"}},
+		{"crd/dns/records", &corev1.ObjectReference{APIVersion: "externaldns.k8s.io/v1alpha1", Kind: "DNSEndpoint", Namespace: "dns", Name: "records"}},
+		{"node/worker-1", &corev1.ObjectReference{APIVersion: "v1", Kind: "Node", Name: "worker-1"}},
+		{"widget/default/web", nil},
+		{"service/default/", nil},
+		{"service", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got, err := ParseObjectReference(tt.resource)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %v", tt.resource, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.resource, err)
+			continue
+		}
+		if *got != *tt.want {
+			t.Errorf("%q: got %v, want %v", tt.resource, got, tt.want)
+		}
+	}
+}
+
+// objectRecorder records the objects events are emitted on, waiting for release if set
+type objectRecorder struct {
+	record.EventRecorder
+	release chan struct{}
+	objects []corev1.ObjectReference
+}
+
+func (r *objectRecorder) Event(object runtime.Object, _, _, _ string) {
+	if r.release != nil {
+		<-r.release
+	}
+	r.objects = append(r.objects, *object.(*corev1.ObjectReference))
+}
+
+// partialObject creates the metadata of an object served by the fake metadata client
+func partialObject(apiVersion, kind, namespace, name, uid string) *metav1.PartialObjectMetadata {
+	return &metav1.PartialObjectMetadata{
+		TypeMeta:   metav1.TypeMeta{APIVersion: apiVersion, Kind: kind},
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, UID: types.UID(uid)},
+	}
+}
+
+func newFakeObjects(t *testing.T, objects ...runtime.Object) *metadatafake.FakeMetadataClient {
+	t.Helper()
+	s := runtime.NewScheme()
+	if err := metav1.AddMetaToScheme(s); err != nil {
+		t.Fatal(err)
+	}
+	return metadatafake.NewSimpleMetadataClient(s, objects...)
+}
+
+func TestRecorderFallback(t *testing.T) {
+	objects := newFakeObjects(t,
+		partialObject("v1", "Service", "default", "web", "uid-web"),
+		partialObject("v1", "Pod", "dns", "webhook", "uid-webhook"))
+	rec := &objectRecorder{}
+	r := NewRecorderFor(rec, objects, "pod/dns/webhook")
+	defer r.Close()
+
+	r.Eventf("service/default/web", TypeNormal, "Test", "with resource")
+	r.Eventf("service/default/web", TypeNormal, "Test", "with cached resource")
+	r.Eventf("ingress/default/missing", TypeNormal, "Test", "with missing resource")
+	r.Eventf("ingress/default/missing", TypeNormal, "Test", "with cached missing resource")
+	r.Eventf("", TypeWarning, "Test", "without %s", "resource")
+	r.Flush()
+
+	web := corev1.ObjectReference{APIVersion: "v1", Kind: "Service", Namespace: "default", Name: "web", UID: "uid-web"}
+	webhook := corev1.ObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: "dns", Name: "webhook", UID: "uid-webhook"}
+	if want := []corev1.ObjectReference{web, web, webhook, webhook, webhook}; !reflect.DeepEqual(rec.objects, want) {
+		t.Errorf("got events on %v, want %v", rec.objects, want)
+	}
+	// the service, the missing ingress and the fallback are looked up once
+	if got := len(objects.Actions()); got != 3 {
+		t.Errorf("got %d lookups, want 3: %v", got, objects.Actions())
+	}
+
+	// events are emitted on the fallback without UID if it cannot be found either
+	rec = &objectRecorder{}
+	unresolved := NewRecorderFor(rec, newFakeObjects(t), "pod/dns/webhook")
+	unresolved.Eventf("service/default/web", TypeNormal, "Test", "unresolved")
+	unresolved.Close()
+	webhook.UID = ""
+	if want := []corev1.ObjectReference{webhook}; !reflect.DeepEqual(rec.objects, want) {
+		t.Errorf("got events on %v, want %v", rec.objects, want)
+	}
+
+	var nilRecorder *Recorder
+	nilRecorder.Eventf("service/default/web", TypeNormal, "Test", "ignored")
+	nilRecorder.Flush()
+	nilRecorder.Close()
+}
+
+func TestRecorderDropsWhenQueueIsFull(t *testing.T) {
+	rec := &objectRecorder{release: make(chan struct{})}
+	r := NewRecorderFor(rec, newFakeObjects(t, partialObject("v1", "Pod", "dns", "webhook", "uid-webhook")), "pod/dns/webhook")
+
+	// the worker waits in the first event while the queue fills up, further events are dropped without blocking
+	r.Eventf("", TypeNormal, "Test", "emitting")
+	for len(r.queue) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for range queueSize + 10 {
+		r.Eventf("", TypeNormal, "Test", "queued")
+	}
+	close(rec.release)
+	r.Close()
+	if got := len(rec.objects); got != queueSize+1 {
+		t.Errorf("got %d events, want %d", got, queueSize+1)
+	}
+
+	r.Eventf("", TypeNormal, "Test", "after close")
+	r.Flush()
+	r.Close()
+	if got := len(rec.objects); got != queueSize+1 {
+		t.Errorf("got %d events after closing, want %d", got, queueSize+1)
+	}
+}
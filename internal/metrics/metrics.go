@@ -9,20 +9,85 @@ var (
 		Name: "external_dns_webhook_openstack_connection_initialized",
 		Help: "Indicates if the webhook has been initialized with OpenStack API credentials (1 for initialized, 0 for not initialized)",
 	})
-	FailedApiCallsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+	FailedApiCallsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "external_dns_webhook_failed_api_calls_total",
 		Help: "Total number of failed API calls",
-	})
-	TotalApiCalls = prometheus.NewCounter(prometheus.CounterOpts{
+	}, []string{"method", "status_class"}) // status_class is one of 2xx, 3xx, 4xx, 5xx or error if there was no response
+	TotalApiCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "external_dns_webhook_total_api_calls",
 		Help: "Total number of API calls",
-	})
-	ApiCallLatency = prometheus.NewSummaryVec(prometheus.SummaryOpts{
-		Name: "external_dns_webhook_api_call_latency_seconds",
-		Help: "Latency of OpenStack API calls",
+	}, []string{"method", "status_class"})
+	ApiCallLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "external_dns_webhook_api_call_latency_seconds",
+		Help:    "Latency of OpenStack API calls",
+		Buckets: []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
 	}, []string{"method"}) // method label to differentiate API calls
+	ManagedZones = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "external_dns_webhook_managed_zones",
+		Help: "Number of zones managed by the webhook",
+	})
+	RecordSets = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "external_dns_webhook_recordsets",
+		Help: "Number of recordsets per managed zone and type as of the last Records call",
+	}, []string{"zone", "type"})
+	AppliedChangesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "external_dns_webhook_applied_changes_total",
+		Help: "Total number of recordset changes applied to Designate",
+	}, []string{"action"}) // action is one of create, update or delete
+	LastSuccessTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "external_dns_webhook_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful call by external-dns",
+	}, []string{"operation"}) // operation is either records or apply_changes
+	LastFailureTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "external_dns_webhook_last_failure_timestamp_seconds",
+		Help: "Unix time of the last failed call by external-dns",
+	}, []string{"operation"})
+	ConsecutiveFailures = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "external_dns_webhook_consecutive_failures",
+		Help: "Number of failed calls by external-dns since the last successful one",
+	}, []string{"operation"})
+	DriftedRecordSets = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "external_dns_webhook_drifted_recordsets",
+		Help: "Number of recordsets changed in Designate after they were last written by the webhook",
+	})
+	DriftDetectedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "external_dns_webhook_drift_detected_total",
+		Help: "Total number of detected out-of-band changes of recordsets",
+	}, []string{"kind"}) // kind is one of modified, deleted or recreated
+	NotificationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "external_dns_webhook_notifications_total",
+		Help: "Total number of change notifications by result",
+	}, []string{"result"}) // result is one of success, failure or dropped
+	ProtectedRecordChangesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "external_dns_webhook_protected_record_changes_total",
+		Help: "Total number of refused attempts to change protected recordsets",
+	})
+	DeletionThresholdExceededTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "external_dns_webhook_deletion_threshold_exceeded_total",
+		Help: "Total number of ApplyChanges calls whose deletions exceeded the deletion threshold",
+	})
+	RollbacksTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "external_dns_webhook_rollbacks_total",
+		Help: "Total number of rolled back ApplyChanges calls",
+	}, []string{"result"}) // result label is either success or partial
+	ZonesCreatedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "external_dns_webhook_zones_created_total",
+		Help: "Total number of zones created automatically for unmatched hostnames",
+	})
+	SkippedRecordsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "external_dns_webhook_skipped_records_total",
+		Help: "Total number of record changes that were not applied",
+	}, []string{"reason", "type"}) // reason is one of no_zone, protected, not_owned or deletion_threshold
+	InjectedFaultsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "external_dns_webhook_injected_faults_total",
+		Help: "Total number of faults injected into API calls by the fault injection test mode",
+	}, []string{"method", "fault"}) // fault is one of error, conflict or pagination
 )
 
 func init() {
-	prometheus.MustRegister(OpenstackConnectionMetric, FailedApiCallsTotal, ApiCallLatency, TotalApiCalls)
+	prometheus.MustRegister(OpenstackConnectionMetric, FailedApiCallsTotal, ApiCallLatency, TotalApiCalls, ManagedZones, RecordSets, AppliedChangesTotal,
+		LastSuccessTimestamp, LastFailureTimestamp, ConsecutiveFailures,
+		DriftedRecordSets, DriftDetectedTotal, NotificationsTotal,
+		ProtectedRecordChangesTotal, DeletionThresholdExceededTotal, RollbacksTotal, ZonesCreatedTotal, SkippedRecordsTotal,
+		InjectedFaultsTotal)
 }
@@ -0,0 +1,331 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package notify posts summaries of applied DNS changes to HTTP endpoints like Slack or Teams incoming webhooks.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"external-dns-openstack-webhook/internal/audit"
+	"external-dns-openstack-webhook/internal/metrics"
+)
+
+// payload presets
+const (
+	PresetJSON  = "json"
+	PresetSlack = "slack"
+	PresetTeams = "teams"
+)
+
+var presets = map[string]string{
+	PresetJSON:  `{{ json . }}`,
+	PresetSlack: `{"text": {{ json (text .) }}}`,
+	PresetTeams: `{"@type": "MessageCard", "@context": "https://schema.org/extensions",
+  "themeColor": "{{ if or .Failed .Error }}D70000{{ else }}2EB886{{ end }}",
+  "summary": {{ json (headline .) }}, "title": {{ json (headline .) }}, "text": {{ json (details .) }}}`,
+}
+
+// results of a notification, used as metric label
+const (
+	resultSuccess = "success"
+	resultFailure = "failure"
+	resultDropped = "dropped"
+)
+
+// Change is a single recordset change of a summary
+type Change struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Action  string   `json:"action,omitempty"`
+	Records []string `json:"records,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// Summary is the outcome of a batch of changes applied to Designate
+type Summary struct {
+	Timestamp time.Time `json:"timestamp"`
+	Created   []Change  `json:"created"`
+	Updated   []Change  `json:"updated"`
+	Deleted   []Change  `json:"deleted"`
+	Failed    []Change  `json:"failed"`
+	// changes reverted by a rollback, with the action of the reverted change
+	RolledBack []Change `json:"rolled_back,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// Add records the outcome of a recordset change, one of the audit actions
+func (s *Summary) Add(action, name, recordType string, records []string, err error) {
+	records = append([]string(nil), records...)
+	sort.Strings(records)
+	change := Change{Name: name, Type: recordType, Records: records}
+	if err != nil {
+		change.Action = action
+		change.Error = err.Error()
+		s.Failed = append(s.Failed, change)
+		return
+	}
+	switch action {
+	case audit.ActionCreate:
+		s.Created = append(s.Created, change)
+	case audit.ActionUpdate:
+		s.Updated = append(s.Updated, change)
+	case audit.ActionDelete:
+		s.Deleted = append(s.Deleted, change)
+	}
+}
+
+// AddRollback records the outcome of reverting a change, action being the audit action of the reverted change
+func (s *Summary) AddRollback(action, name, recordType string, records []string, err error) {
+	records = append([]string(nil), records...)
+	sort.Strings(records)
+	change := Change{Name: name, Type: recordType, Action: action, Records: records}
+	if err != nil {
+		change.Error = err.Error()
+	}
+	s.RolledBack = append(s.RolledBack, change)
+}
+
+// Empty tells whether the summary holds neither changes nor an error
+func (s *Summary) Empty() bool {
+	return len(s.Created)+len(s.Updated)+len(s.Deleted)+len(s.Failed)+len(s.RolledBack) == 0 && s.Error == ""
+}
+
+// Text renders the summary for humans
+func (s *Summary) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "DNS changes: %d created, %d updated, %d deleted, %d failed",
+		len(s.Created), len(s.Updated), len(s.Deleted), len(s.Failed))
+	for _, group := range []struct {
+		verb    string
+		changes []Change
+	}{{"created", s.Created}, {"updated", s.Updated}, {"deleted", s.Deleted}} {
+		for _, c := range group.changes {
+			fmt.Fprintf(&b, "\n• %s %s/%s", group.verb, c.Name, c.Type)
+			if len(c.Records) > 0 {
+				fmt.Fprintf(&b, ": %s", strings.Join(c.Records, ", "))
+			}
+		}
+	}
+	for _, c := range s.Failed {
+		fmt.Fprintf(&b, "\n• failed to %s %s/%s: %s", c.Action, c.Name, c.Type, c.Error)
+	}
+	for _, c := range s.RolledBack {
+		if c.Error != "" {
+			fmt.Fprintf(&b, "\n• failed to roll back %s of %s/%s: %s", c.Action, c.Name, c.Type, c.Error)
+			continue
+		}
+		fmt.Fprintf(&b, "\n• rolled back %s of %s/%s", c.Action, c.Name, c.Type)
+	}
+	if s.Error != "" {
+		fmt.Fprintf(&b, "\nError: %s", s.Error)
+	}
+	return b.String()
+}
+
+// headline is the first line of the text of a summary
+func headline(s *Summary) string {
+	text, _, _ := strings.Cut(s.Text(), "\n")
+	return text
+}
+
+// details are the lines of the text of a summary following the headline, as paragraphs of Teams markdown
+func details(s *Summary) string {
+	_, text, _ := strings.Cut(s.Text(), "\n")
+	return strings.ReplaceAll(text, "\n", "\n\n")
+}
+
+// Config configures a Notifier
+type Config struct {
+	URL string
+	// one of the presets, ignored if TemplateFile is set
+	Preset string
+	// Go text/template file rendering the request body from a Summary
+	TemplateFile string
+	// number of retries of failed deliveries
+	Retries int
+	// delay before the first retry, doubled for every further one
+	RetryBackoff time.Duration
+	// maximum number of summaries waiting for delivery, further ones are dropped
+	QueueSize int
+	// timeout of a single request
+	Timeout time.Duration
+}
+
+// Notifier delivers summaries asynchronously, retrying failed deliveries. A nil *Notifier delivers nothing.
+type Notifier struct {
+	config   Config
+	template *template.Template
+	client   *http.Client
+	queue    chan *Summary
+	done     chan struct{}
+
+	// guards closing the queue against concurrent Notify calls
+	mu     sync.RWMutex
+	closed bool
+}
+
+// New creates a Notifier and starts its delivery worker
+func New(config Config) (*Notifier, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("notification URL is required")
+	}
+	text, ok := presets[config.Preset]
+	if config.TemplateFile != "" {
+		data, err := os.ReadFile(config.TemplateFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read notification template: %w", err)
+		}
+		text = string(data)
+	} else if !ok {
+		return nil, fmt.Errorf("unknown notification preset %q, must be one of json, slack or teams", config.Preset)
+	}
+	tmpl, err := template.New("notification").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+		"text":     func(s *Summary) string { return s.Text() },
+		"headline": headline,
+		"details":  details,
+		"join":     strings.Join,
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notification template: %w", err)
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = time.Second
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 100
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	n := &Notifier{
+		config:   config,
+		template: tmpl,
+		client:   &http.Client{Timeout: config.Timeout},
+		queue:    make(chan *Summary, config.QueueSize),
+		done:     make(chan struct{}),
+	}
+	go n.run()
+	return n, nil
+}
+
+// Notify queues the summary for delivery without blocking. Empty summaries, and summaries notified after Close,
+// are not delivered.
+func (n *Notifier) Notify(s *Summary) {
+	if n == nil || s.Empty() {
+		return
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.closed {
+		log.Warnf("Dropping notification because the notifier is closed")
+		metrics.NotificationsTotal.WithLabelValues(resultDropped).Inc()
+		return
+	}
+	select {
+	case n.queue <- s:
+	default:
+		log.Warnf("Dropping notification because %d notifications are waiting for delivery", cap(n.queue))
+		metrics.NotificationsTotal.WithLabelValues(resultDropped).Inc()
+	}
+}
+
+// Close waits until the queued summaries are delivered or ctx is done
+func (n *Notifier) Close(ctx context.Context) error {
+	if n == nil {
+		return nil
+	}
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.queue)
+	}
+	n.mu.Unlock()
+	select {
+	case <-n.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run delivers the queued summaries until the queue is closed
+func (n *Notifier) run() {
+	defer close(n.done)
+	for s := range n.queue {
+		var body bytes.Buffer
+		if err := n.template.Execute(&body, s); err != nil {
+			log.Errorf("Failed to render notification: %v", err)
+			metrics.NotificationsTotal.WithLabelValues(resultFailure).Inc()
+			continue
+		}
+		if err := n.deliver(body.Bytes()); err != nil {
+			log.Errorf("Failed to deliver notification: %v", err)
+			metrics.NotificationsTotal.WithLabelValues(resultFailure).Inc()
+			continue
+		}
+		metrics.NotificationsTotal.WithLabelValues(resultSuccess).Inc()
+	}
+}
+
+// deliver posts the body, retrying network errors, server errors and rate limiting
+func (n *Notifier) deliver(body []byte) error {
+	backoff := n.config.RetryBackoff
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = n.post(body)
+		if err == nil || !retry || attempt >= n.config.Retries {
+			return err
+		}
+		log.Debugf("Retrying notification in %s after error: %v", backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends a single request and tells whether a failure is worth retrying
+func (n *Notifier) post(body []byte) (bool, error) {
+	resp, err := n.client.Post(n.config.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("notification endpoint responded with %s", resp.Status)
+}
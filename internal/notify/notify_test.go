@@ -0,0 +1,267 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"external-dns-openstack-webhook/internal/audit"
+	"external-dns-openstack-webhook/internal/metrics"
+)
+
+// recordingServer answers with the given status codes in turn, then with 200, and records the request bodies
+func recordingServer(t *testing.T, statusCodes ...int) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		bodies = append(bodies, string(body))
+		if len(bodies) <= len(statusCodes) {
+			w.WriteHeader(statusCodes[len(bodies)-1])
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), bodies...)
+	}
+}
+
+func testSummary() *Summary {
+	s := &Summary{Timestamp: time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)}
+	s.Add(audit.ActionCreate, "www.example.com.", "A", []string{"10.0.0.2", "10.0.0.1"}, nil)
+	s.Add(audit.ActionDelete, "old.example.com.", "CNAME", nil, nil)
+	s.Add(audit.ActionUpdate, "api.example.com.", "A", []string{"10.0.0.3"}, errors.New("quota exceeded"))
+	return s
+}
+
+func TestNotifierSlackPreset(t *testing.T) {
+	server, bodies := recordingServer(t)
+	n, err := New(Config{URL: server.URL, Preset: PresetSlack})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Notify(testSummary())
+	n.Notify(&Summary{})
+	if err := n.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := bodies()
+	if len(got) != 1 {
+		t.Fatalf("got %d requests, expected 1", len(got))
+	}
+	var payload struct{ Text string }
+	if err := json.Unmarshal([]byte(got[0]), &payload); err != nil {
+		t.Fatalf("invalid payload %q: %v", got[0], err)
+	}
+	want := "DNS changes: 1 created, 0 updated, 1 deleted, 1 failed\n" +
+		"• created www.example.com./A: 10.0.0.1, 10.0.0.2\n" +
+		"• deleted old.example.com./CNAME\n" +
+		"• failed to update api.example.com./A: quota exceeded"
+	if payload.Text != want {
+		t.Errorf("got text\n%s\nwant\n%s", payload.Text, want)
+	}
+}
+
+func TestSummaryRollbackText(t *testing.T) {
+	s := &Summary{}
+	s.Add(audit.ActionCreate, "www.example.com.", "A", []string{"10.0.0.1"}, nil)
+	s.Add(audit.ActionCreate, "api.example.com.", "A", []string{"10.0.0.2"}, errors.New("quota exceeded"))
+	s.AddRollback(audit.ActionCreate, "www.example.com.", "A", nil, nil)
+	s.AddRollback(audit.ActionDelete, "old.example.com.", "A", []string{"10.0.0.3"}, errors.New("conflict"))
+	want := "DNS changes: 1 created, 0 updated, 0 deleted, 1 failed\n" +
+		"• created www.example.com./A: 10.0.0.1\n" +
+		"• failed to create api.example.com./A: quota exceeded\n" +
+		"• rolled back create of www.example.com./A\n" +
+		"• failed to roll back delete of old.example.com./A: conflict"
+	if got := s.Text(); got != want {
+		t.Errorf("got text\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestNotifierTeamsPreset(t *testing.T) {
+	server, bodies := recordingServer(t)
+	n, err := New(Config{URL: server.URL, Preset: PresetTeams})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Notify(testSummary())
+	if err := n.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := bodies()
+	if len(got) != 1 {
+		t.Fatalf("got %d requests, expected 1", len(got))
+	}
+	var payload map[string]string
+	if err := json.Unmarshal([]byte(got[0]), &payload); err != nil {
+		t.Fatalf("invalid payload %q: %v", got[0], err)
+	}
+	want := map[string]string{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"themeColor": "D70000",
+		"summary":    "DNS changes: 1 created, 0 updated, 1 deleted, 1 failed",
+		"title":      "DNS changes: 1 created, 0 updated, 1 deleted, 1 failed",
+		"text": "• created www.example.com./A: 10.0.0.1, 10.0.0.2\n\n" +
+			"• deleted old.example.com./CNAME\n\n" +
+			"• failed to update api.example.com./A: quota exceeded",
+	}
+	if !reflect.DeepEqual(payload, want) {
+		t.Errorf("got payload\n%v\nwant\n%v", payload, want)
+	}
+}
+
+func TestNotifierNotifyAfterClose(t *testing.T) {
+	server, bodies := recordingServer(t)
+	n, err := New(Config{URL: server.URL, Preset: PresetJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	dropped := testutil.ToFloat64(metrics.NotificationsTotal.WithLabelValues(resultDropped))
+	n.Notify(testSummary())
+	if err := n.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := bodies(); len(got) != 0 {
+		t.Errorf("got %d requests after closing, expected none", len(got))
+	}
+	if got := testutil.ToFloat64(metrics.NotificationsTotal.WithLabelValues(resultDropped)) - dropped; got != 1 {
+		t.Errorf("got %v dropped notifications, expected 1", got)
+	}
+}
+
+func TestNotifierRetries(t *testing.T) {
+	server, bodies := recordingServer(t, http.StatusBadGateway, http.StatusTooManyRequests)
+	n, err := New(Config{URL: server.URL, Preset: PresetJSON, Retries: 2, RetryBackoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	succeeded := testutil.ToFloat64(metrics.NotificationsTotal.WithLabelValues(resultSuccess))
+	n.Notify(testSummary())
+	if err := n.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := bodies()
+	if len(got) != 3 {
+		t.Fatalf("got %d requests, expected 3", len(got))
+	}
+	var summary Summary
+	if err := json.Unmarshal([]byte(got[2]), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Created) != 1 || len(summary.Deleted) != 1 || len(summary.Failed) != 1 {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+	if got := testutil.ToFloat64(metrics.NotificationsTotal.WithLabelValues(resultSuccess)) - succeeded; got != 1 {
+		t.Errorf("got %v successful notifications, expected 1", got)
+	}
+}
+
+func TestNotifierGivesUpOnClientErrors(t *testing.T) {
+	server, bodies := recordingServer(t, http.StatusBadRequest)
+	n, err := New(Config{URL: server.URL, Preset: PresetJSON, Retries: 3, RetryBackoff: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Notify(testSummary())
+	if err := n.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(bodies()); got != 1 {
+		t.Errorf("got %d requests, expected 1", got)
+	}
+}
+
+func TestNotifierDropsWhenQueueIsFull(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	n, err := New(Config{URL: server.URL, Preset: PresetJSON, QueueSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dropped := testutil.ToFloat64(metrics.NotificationsTotal.WithLabelValues(resultDropped))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 5 {
+			n.Notify(testSummary())
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Notify blocked")
+	}
+	if got := testutil.ToFloat64(metrics.NotificationsTotal.WithLabelValues(resultDropped)) - dropped; got < 3 {
+		t.Errorf("got %v dropped notifications, expected at least 3", got)
+	}
+	close(release)
+	if err := n.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNotifierTemplateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "template.json")
+	if err := os.WriteFile(path, []byte(`{"created": {{ len .Created }}, "first": {{ json (index .Created 0).Name }}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	server, bodies := recordingServer(t)
+	n, err := New(Config{URL: server.URL, TemplateFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.Notify(testSummary())
+	if err := n.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := bodies(); len(got) != 1 || got[0] != `{"created": 1, "first": "www.example.com."}` {
+		t.Errorf("got %q", got)
+	}
+
+	if _, err := New(Config{URL: server.URL, Preset: "unknown"}); err == nil {
+		t.Error("expected an error for an unknown preset")
+	}
+}
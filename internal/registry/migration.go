@@ -0,0 +1,166 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"maps"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"sigs.k8s.io/external-dns/registry/mapper"
+)
+
+// Migration rewrites the TXT ownership records of an owner, e.g. as left behind by the in-tree designate provider,
+// into the current format of the TXT registry
+type Migration struct {
+	// owner ID found in the existing TXT records
+	OldOwnerID string
+	// owner ID the TXT records are rewritten to, the old one is kept if empty
+	NewOwnerID string
+	// maps between record names and the names of the TXT records owning them
+	NameMapper mapper.NameMapper
+	// keep TXT records in the old format, which doesn't encode the record type, instead of deleting them
+	KeepOldFormat bool
+}
+
+// NewMigration creates a Migration using the TXT registry settings of external-dns
+func NewMigration(oldOwnerID, newOwnerID, prefix, suffix, wildcardReplacement string, keepOldFormat bool) Migration {
+	return Migration{
+		OldOwnerID:    oldOwnerID,
+		NewOwnerID:    newOwnerID,
+		NameMapper:    mapper.NewAffixNameMapper(prefix, suffix, wildcardReplacement),
+		KeepOldFormat: keepOldFormat,
+	}
+}
+
+// MigrationPlan holds the changes that migrate the TXT records of an owner
+type MigrationPlan struct {
+	// changes to the TXT records, to be applied with ApplyChanges
+	Changes plan.Changes
+	// records of the migrated owner including their TXT records, which are taken over as a whole
+	Owned []*endpoint.Endpoint
+}
+
+// Plan computes the changes migrating the TXT records of the old owner among records. For every record they own,
+// a TXT record in the current format owned by the new owner is created or updated, unless it belongs to somebody else.
+// TXT records in the old format are deleted once replaced unless KeepOldFormat is set. The owner of all remaining TXT
+// records of the old owner is updated.
+func (m Migration) Plan(records []*endpoint.Endpoint) MigrationPlan {
+	newOwnerID := m.NewOwnerID
+	if newOwnerID == "" {
+		newOwnerID = m.OldOwnerID
+	}
+
+	type ownership struct {
+		txt        *endpoint.Endpoint
+		labels     endpoint.Labels
+		name       string
+		recordType string
+	}
+	var ownerships []ownership
+	registryRecords := map[string]*endpoint.Endpoint{}
+	registryOwners := map[string]string{}
+	targets := map[string][]*endpoint.Endpoint{}
+	for _, ep := range records {
+		if ep.RecordType == endpoint.RecordTypeTXT && len(ep.Targets) > 0 {
+			if labels, err := endpoint.NewLabelsFromStringPlain(ep.Targets[0]); err == nil {
+				registryRecords[normalizeName(ep.DNSName)] = ep
+				registryOwners[normalizeName(ep.DNSName)] = labels[endpoint.OwnerLabelKey]
+				name, recordType := m.NameMapper.ToEndpointName(normalizeName(ep.DNSName))
+				if labels[endpoint.OwnerLabelKey] == m.OldOwnerID && name != "" {
+					ownerships = append(ownerships, ownership{txt: ep, labels: labels, name: name, recordType: recordType})
+				}
+				continue
+			}
+		}
+		name := normalizeName(ep.DNSName)
+		targets[name] = append(targets[name], ep)
+	}
+
+	var result MigrationPlan
+	owned := map[*endpoint.Endpoint]bool{}
+	planned := map[string]bool{}
+	update := func(txt *endpoint.Endpoint, value string) {
+		owned[txt] = true
+		if txt.Targets[0] != value {
+			result.Changes.UpdateOld = append(result.Changes.UpdateOld, txt)
+			result.Changes.UpdateNew = append(result.Changes.UpdateNew, withTargets(txt, value))
+		}
+	}
+	for _, o := range ownerships {
+		labels := maps.Clone(o.labels)
+		labels[endpoint.OwnerLabelKey] = newOwnerID
+		value := labels.SerializePlain(true)
+
+		migrated := 0
+		for _, target := range targets[o.name] {
+			if o.recordType != "" && target.RecordType != o.recordType || !knownRecordTypes[target.RecordType] {
+				continue
+			}
+			txtName := m.NameMapper.ToTXTName(normalizeName(target.DNSName), target.RecordType)
+			switch owner := registryOwners[txtName]; {
+			case planned[txtName]:
+			case registryRecords[txtName] == nil:
+				result.Changes.Create = append(result.Changes.Create, endpoint.NewEndpoint(txtName, endpoint.RecordTypeTXT, value))
+			case owner == m.OldOwnerID || owner == newOwnerID:
+				update(registryRecords[txtName], value)
+			default:
+				// owned by somebody else, leave the record alone
+				continue
+			}
+			planned[txtName] = true
+			owned[target] = true
+			migrated++
+		}
+
+		switch {
+		case planned[normalizeName(o.txt.DNSName)]:
+		case o.recordType == "" && migrated > 0 && !m.KeepOldFormat:
+			owned[o.txt] = true
+			result.Changes.Delete = append(result.Changes.Delete, o.txt)
+		default:
+			update(o.txt, value)
+		}
+	}
+
+	for _, ep := range records {
+		if owned[ep] {
+			result.Owned = append(result.Owned, ep)
+		}
+	}
+	for _, eps := range [][]*endpoint.Endpoint{result.Changes.Create, result.Changes.Delete, result.Owned} {
+		sort.SliceStable(eps, func(i, j int) bool {
+			return eps[i].DNSName < eps[j].DNSName
+		})
+	}
+	return result
+}
+
+// withTargets returns a copy of ep with the given targets
+func withTargets(ep *endpoint.Endpoint, targets ...string) *endpoint.Endpoint {
+	c := *ep
+	c.Targets = targets
+	c.Labels = maps.Clone(ep.Labels)
+	return &c
+}
+
+// normalizeName returns a DNS name in lower case without trailing dot
+func normalizeName(dnsName string) string {
+	return strings.ToLower(strings.TrimSuffix(dnsName, "."))
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func names(eps []*endpoint.Endpoint) []string {
+	var result []string
+	for _, ep := range eps {
+		result = append(result, ep.DNSName+" "+ep.RecordType+" "+strings.Join(ep.Targets, ","))
+	}
+	return result
+}
+
+func TestMigrationPlan(t *testing.T) {
+	records := []*endpoint.Endpoint{
+		// old format owning an A record
+		endpoint.NewEndpoint("www.example.com.", endpoint.RecordTypeA, "10.1.1.1"),
+		endpoint.NewEndpoint("www.example.com.", endpoint.RecordTypeTXT, ownership("legacy")),
+		// old format with the new format record already present
+		endpoint.NewEndpoint("api.example.com.", endpoint.RecordTypeA, "10.1.1.2"),
+		endpoint.NewEndpoint("api.example.com.", endpoint.RecordTypeTXT, ownership("legacy")),
+		endpoint.NewEndpoint("a-api.example.com.", endpoint.RecordTypeTXT, ownership("legacy")),
+		// new format record of a type not returned by the provider
+		endpoint.NewEndpoint("aaaa-v6.example.com.", endpoint.RecordTypeTXT, ownership("legacy")),
+		// old format without any record left
+		endpoint.NewEndpoint("gone.example.com.", endpoint.RecordTypeTXT, ownership("legacy")),
+		// new format record owned by somebody else
+		endpoint.NewEndpoint("mail.example.com.", endpoint.RecordTypeA, "10.1.1.3"),
+		endpoint.NewEndpoint("mail.example.com.", endpoint.RecordTypeTXT, ownership("legacy")),
+		endpoint.NewEndpoint("a-mail.example.com.", endpoint.RecordTypeTXT, ownership("other")),
+		// not owned by the migrated owner at all
+		endpoint.NewEndpoint("other.example.com.", endpoint.RecordTypeA, "10.1.1.4"),
+		endpoint.NewEndpoint("a-other.example.com.", endpoint.RecordTypeTXT, ownership("other")),
+	}
+
+	result := NewMigration("legacy", "me", "", "", "", false).Plan(records)
+	if got, expected := names(result.Changes.Create), []string{`a-www.example.com TXT ` + ownership("me")}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got creates %v, expected %v", got, expected)
+	}
+	if got, expected := names(result.Changes.UpdateNew), []string{
+		`a-api.example.com TXT ` + ownership("me"),
+		`aaaa-v6.example.com TXT ` + ownership("me"),
+		`gone.example.com TXT ` + ownership("me"),
+		`mail.example.com TXT ` + ownership("me"),
+	}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got updates %v, expected %v", got, expected)
+	}
+	if got, expected := result.Changes.Delete, []*endpoint.Endpoint{records[3], records[1]}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got deletes %v, expected %v", names(got), names(expected))
+	}
+	if got, expected := result.Owned, []*endpoint.Endpoint{records[4], records[5], records[2], records[3], records[6], records[8], records[0], records[1]}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got owned %v, expected %v", names(got), names(expected))
+	}
+
+	result = NewMigration("legacy", "", "", "", "", true).Plan(records)
+	if len(result.Changes.Delete) != 0 || len(result.Changes.UpdateNew) != 0 || len(result.Changes.Create) != 1 {
+		t.Errorf("unexpected changes when keeping the owner and the old format %+v", result.Changes)
+	}
+}
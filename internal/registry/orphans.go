@@ -0,0 +1,103 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/registry/mapper"
+)
+
+// record types returned by the provider, ownership records for other types can't be judged
+var knownRecordTypes = map[string]bool{
+	endpoint.RecordTypeA:     true,
+	endpoint.RecordTypeCNAME: true,
+	endpoint.RecordTypeTXT:   true,
+}
+
+// OrphanFinder finds TXT ownership records of the external-dns TXT registry whose owned record is gone
+type OrphanFinder struct {
+	// owner ID of the TXT registry, i.e. --txt-owner-id of external-dns
+	OwnerID string
+	// maps TXT record names to the names and types of the records they own
+	NameMapper mapper.NameMapper
+	// replacement of a leading "*" in the names of TXT records owning wildcard records
+	WildcardReplacement string
+}
+
+// NewOrphanFinder creates an OrphanFinder using the TXT registry settings of external-dns
+func NewOrphanFinder(ownerID, prefix, suffix, wildcardReplacement string) OrphanFinder {
+	return OrphanFinder{
+		OwnerID:             ownerID,
+		NameMapper:          mapper.NewAffixNameMapper(prefix, suffix, wildcardReplacement),
+		WildcardReplacement: strings.ToLower(wildcardReplacement),
+	}
+}
+
+// FindOrphans returns the TXT ownership records of the owner ID among records, ordered by name, for which no record
+// of the owned name and type exists. Records in the old registry format, which don't encode the type, are orphaned
+// if there is no record of any type with the owned name.
+func (f OrphanFinder) FindOrphans(records []*endpoint.Endpoint) []*endpoint.Endpoint {
+	type owned struct {
+		txt        *endpoint.Endpoint
+		name       string
+		recordType string
+	}
+	var candidates []owned
+	targets := map[string]bool{}
+	for _, ep := range records {
+		if ep.RecordType == endpoint.RecordTypeTXT && len(ep.Targets) > 0 {
+			labels, err := endpoint.NewLabelsFromStringPlain(ep.Targets[0])
+			if err == nil {
+				name, recordType := f.NameMapper.ToEndpointName(strings.TrimSuffix(ep.DNSName, "."))
+				if labels[endpoint.OwnerLabelKey] == f.OwnerID && name != "" && (recordType == "" || knownRecordTypes[recordType]) {
+					candidates = append(candidates, owned{txt: ep, name: name, recordType: recordType})
+				}
+				continue
+			}
+		}
+		name := f.registryName(ep.DNSName)
+		targets[name+"/"+ep.RecordType] = true
+		targets[name+"/"] = true
+	}
+
+	var orphans []*endpoint.Endpoint
+	for _, c := range candidates {
+		if !targets[c.name+"/"+c.recordType] {
+			orphans = append(orphans, c.txt)
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool {
+		return orphans[i].DNSName < orphans[j].DNSName
+	})
+	return orphans
+}
+
+// registryName returns the endpoint name as encoded in the names of TXT ownership records
+func (f OrphanFinder) registryName(dnsName string) string {
+	name := strings.ToLower(strings.TrimSuffix(dnsName, "."))
+	if f.WildcardReplacement != "" {
+		if rest, ok := strings.CutPrefix(name, "*."); ok {
+			name = f.WildcardReplacement + "." + rest
+		} else if name == "*" {
+			name = f.WildcardReplacement
+		}
+	}
+	return name
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package registry
+
+import (
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func ownership(owner string) string {
+	return `"heritage=external-dns,external-dns/owner=` + owner + `,external-dns/resource=ingress/default/web"`
+}
+
+func TestFindOrphans(t *testing.T) {
+	records := []*endpoint.Endpoint{
+		endpoint.NewEndpoint("www.example.com.", endpoint.RecordTypeA, "10.1.1.1"),
+		endpoint.NewEndpoint("a-www.example.com.", endpoint.RecordTypeTXT, ownership("me")),
+		endpoint.NewEndpoint("cname-www.example.com.", endpoint.RecordTypeTXT, ownership("me")),
+		endpoint.NewEndpoint("a-gone.example.com.", endpoint.RecordTypeTXT, ownership("me")),
+		endpoint.NewEndpoint("a-foreign.example.com.", endpoint.RecordTypeTXT, ownership("other")),
+		endpoint.NewEndpoint("aaaa-v6.example.com.", endpoint.RecordTypeTXT, ownership("me")),
+		endpoint.NewEndpoint("old.example.com.", endpoint.RecordTypeTXT, ownership("me")),
+		endpoint.NewEndpoint("alias.example.com.", endpoint.RecordTypeCNAME, "www.example.com."),
+		endpoint.NewEndpoint("alias.example.com.", endpoint.RecordTypeTXT, ownership("me")),
+		endpoint.NewEndpoint("a-wild.example.com.", endpoint.RecordTypeTXT, ownership("me")),
+		endpoint.NewEndpoint("*.example.com.", endpoint.RecordTypeA, "10.1.1.2"),
+		endpoint.NewEndpoint("plain.example.com.", endpoint.RecordTypeTXT, `"v=spf1 -all"`),
+	}
+	orphans := NewOrphanFinder("me", "", "", "wild").FindOrphans(records)
+	expected := []*endpoint.Endpoint{records[3], records[2], records[6]}
+	if !reflect.DeepEqual(orphans, expected) {
+		t.Errorf("got orphans %v, expected %v", orphans, expected)
+	}
+}
+
+func TestFindOrphansWithAffix(t *testing.T) {
+	records := []*endpoint.Endpoint{
+		endpoint.NewEndpoint("www.example.com.", endpoint.RecordTypeA, "10.1.1.1"),
+		endpoint.NewEndpoint("reg-a-www.example.com.", endpoint.RecordTypeTXT, ownership("me")),
+		endpoint.NewEndpoint("reg-cname-www.example.com.", endpoint.RecordTypeTXT, ownership("me")),
+		endpoint.NewEndpoint("cname-www.example.com.", endpoint.RecordTypeTXT, ownership("me")),
+	}
+	orphans := NewOrphanFinder("me", "reg-", "", "").FindOrphans(records)
+	expected := []*endpoint.Endpoint{records[2]}
+	if !reflect.DeepEqual(orphans, expected) {
+		t.Errorf("got orphans %v, expected %v", orphans, expected)
+	}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"sigs.k8s.io/external-dns/provider"
+)
+
+// requestProvider runs the calls of a provider in the context of a webhook request with a span per call.
+// The webhook API of external-dns calls the provider without the request context, which is why it is bound here.
+type requestProvider struct {
+	provider.Provider
+	ctx context.Context
+}
+
+// WithRequestContext returns a provider that traces the calls to p as children of the span in ctx, ignoring
+// the context passed to the calls themselves. The calls are not cancelled with ctx, like the ones of api.StartHTTPApi,
+// so that a request dropped by external-dns does not abort a batch of changes half-way through.
+func WithRequestContext(ctx context.Context, p provider.Provider) provider.Provider {
+	return requestProvider{Provider: p, ctx: context.WithoutCancel(ctx)}
+}
+
+// Records returns the records of the wrapped provider
+func (p requestProvider) Records(context.Context) ([]*endpoint.Endpoint, error) {
+	ctx, span := Tracer().Start(p.ctx, "Records")
+	endpoints, err := p.Provider.Records(ctx)
+	span.SetAttributes(attribute.Int("endpoints.count", len(endpoints)))
+	End(span, err)
+	return endpoints, err
+}
+
+// ApplyChanges applies the changes using the wrapped provider
+func (p requestProvider) ApplyChanges(_ context.Context, changes *plan.Changes) error {
+	ctx, span := Tracer().Start(p.ctx, "ApplyChanges")
+	span.SetAttributes(
+		attribute.Int("changes.create", len(changes.Create)),
+		attribute.Int("changes.update", len(changes.UpdateNew)),
+		attribute.Int("changes.delete", len(changes.Delete)),
+	)
+	err := p.Provider.ApplyChanges(ctx, changes)
+	End(span, err)
+	return err
+}
+
+// AdjustEndpoints adjusts the endpoints using the wrapped provider
+func (p requestProvider) AdjustEndpoints(endpoints []*endpoint.Endpoint) ([]*endpoint.Endpoint, error) {
+	_, span := Tracer().Start(p.ctx, "AdjustEndpoints")
+	span.SetAttributes(attribute.Int("endpoints.count", len(endpoints)))
+	endpoints, err := p.Provider.AdjustEndpoints(endpoints)
+	End(span, err)
+	return endpoints, err
+}
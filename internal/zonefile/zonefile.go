@@ -0,0 +1,129 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package zonefile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// RecordSet holds all records of a name and type, records are in presentation format as used by Designate
+type RecordSet struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	TTL     int      `json:"ttl,omitempty"`
+	Records []string `json:"records"`
+}
+
+// Sort orders recordsets with the SOA first, followed by the remaining recordsets by name and type
+func Sort(recordSets []RecordSet) {
+	sort.SliceStable(recordSets, func(i, j int) bool {
+		a, b := recordSets[i], recordSets[j]
+		if (a.Type == "SOA") != (b.Type == "SOA") {
+			return a.Type == "SOA"
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Type < b.Type
+	})
+}
+
+// Write writes the recordsets as RFC 1035 zone file for the zone origin. Names are written relative to the origin,
+// a TTL of 0 is omitted so that the record falls back to the default TTL of the zone, written as $TTL if not 0.
+func Write(w io.Writer, origin string, defaultTTL int, recordSets []RecordSet) error {
+	origin = fqdn(origin)
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "$ORIGIN %s\n", origin)
+	if defaultTTL > 0 {
+		fmt.Fprintf(bw, "$TTL %d\n", defaultTTL)
+	}
+
+	sorted := append([]RecordSet(nil), recordSets...)
+	Sort(sorted)
+	for _, rs := range sorted {
+		name := relativeName(rs.Name, origin)
+		ttl := ""
+		if rs.TTL > 0 {
+			ttl = fmt.Sprint(rs.TTL)
+		}
+		records := append([]string(nil), rs.Records...)
+		sort.Strings(records)
+		for _, record := range records {
+			fmt.Fprintf(bw, "%s\t%s\tIN\t%s\t%s\n", name, ttl, rs.Type, record)
+		}
+	}
+	return bw.Flush()
+}
+
+// Parse reads an RFC 1035 zone file, resolving relative names against origin unless the file sets $ORIGIN itself.
+// The records are aggregated into recordsets by name and type. Records without TTL get the one of the $TTL directive,
+// or 0 if there is none.
+func Parse(r io.Reader, origin string) ([]RecordSet, error) {
+	zp := dns.NewZoneParser(r, fqdn(origin), "")
+	zp.SetDefaultTTL(0)
+
+	var result []RecordSet
+	index := map[string]int{}
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		h := rr.Header()
+		name := strings.ToLower(h.Name)
+		recordType := dns.TypeToString[h.Rrtype]
+		record := strings.TrimPrefix(rr.String(), h.String())
+
+		key := name + "/" + recordType
+		i, ok := index[key]
+		if !ok {
+			i = len(result)
+			index[key] = i
+			result = append(result, RecordSet{Name: name, Type: recordType, TTL: int(h.Ttl)})
+		}
+		if !slices.Contains(result[i].Records, record) {
+			result[i].Records = append(result[i].Records, record)
+		}
+	}
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// relativeName returns name relative to origin, "@" for the origin itself
+func relativeName(name, origin string) string {
+	name = fqdn(name)
+	if strings.EqualFold(name, origin) {
+		return "@"
+	}
+	if strings.HasSuffix(strings.ToLower(name), "."+strings.ToLower(origin)) {
+		return name[:len(name)-len(origin)-1]
+	}
+	return name
+}
+
+// fqdn appends the trailing dot to name if missing
+func fqdn(name string) string {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return name
+}
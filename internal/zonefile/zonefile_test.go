@@ -0,0 +1,102 @@
+/*
+Copyright 2024 inovex GmbH.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package zonefile
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	recordSets := []RecordSet{
+		{Name: "www.example.com.", Type: "A", TTL: 300, Records: []string{"10.1.1.2", "10.1.1.1"}},
+		{Name: "example.com.", Type: "NS", TTL: 3600, Records: []string{"ns1.example.net."}},
+		{Name: "txt.example.com.", Type: "TXT", Records: []string{`"hello world"`}},
+		{Name: "example.com.", Type: "SOA", TTL: 3600, Records: []string{"ns1.example.net. admin.example.com. 1 3600 600 86400 3600"}},
+		{Name: "other.example.org.", Type: "CNAME", TTL: 60, Records: []string{"www.example.com."}},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, "example.com", 0, recordSets); err != nil {
+		t.Fatal(err)
+	}
+	expected := "$ORIGIN example.com.\n" +
+		"@\t3600\tIN\tSOA\tns1.example.net. admin.example.com. 1 3600 600 86400 3600\n" +
+		"@\t3600\tIN\tNS\tns1.example.net.\n" +
+		"other.example.org.\t60\tIN\tCNAME\twww.example.com.\n" +
+		"txt\t\tIN\tTXT\t\"hello world\"\n" +
+		"www\t300\tIN\tA\t10.1.1.1\n" +
+		"www\t300\tIN\tA\t10.1.1.2\n"
+	if buf.String() != expected {
+		t.Errorf("got\n%s\nexpected\n%s", buf.String(), expected)
+	}
+	if recordSets[0].Records[0] != "10.1.1.2" {
+		t.Errorf("Write modified its input")
+	}
+}
+
+func TestParse(t *testing.T) {
+	zone := `$TTL 3600
+@	IN	SOA	ns1.example.net. admin.example.com. (
+		1 3600 600 86400 3600 ) ; multi-line
+	IN	NS	ns1.example.net.
+www	300	IN	A	10.1.1.1
+WWW	300	IN	A	10.1.1.2
+txt		IN	TXT	"hello; world"
+alias.example.org.	60	CNAME	www
+`
+	recordSets, err := Parse(strings.NewReader(zone), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []RecordSet{
+		{Name: "example.com.", Type: "SOA", TTL: 3600, Records: []string{"ns1.example.net. admin.example.com. 1 3600 600 86400 3600"}},
+		{Name: "example.com.", Type: "NS", TTL: 3600, Records: []string{"ns1.example.net."}},
+		{Name: "www.example.com.", Type: "A", TTL: 300, Records: []string{"10.1.1.1", "10.1.1.2"}},
+		{Name: "txt.example.com.", Type: "TXT", TTL: 3600, Records: []string{`"hello; world"`}},
+		{Name: "alias.example.org.", Type: "CNAME", TTL: 60, Records: []string{"www.example.com."}},
+	}
+	if !reflect.DeepEqual(recordSets, expected) {
+		t.Errorf("got %+v, expected %+v", recordSets, expected)
+	}
+
+	if _, err := Parse(strings.NewReader("www IN A not-an-ip\n"), "example.com"); err == nil {
+		t.Error("expected error for invalid record")
+	}
+}
+
+func TestWriteParseRoundTrip(t *testing.T) {
+	recordSets := []RecordSet{
+		{Name: "example.com.", Type: "SOA", TTL: 3600, Records: []string{"ns1.example.net. admin.example.com. 1 3600 600 86400 3600"}},
+		{Name: "mx.example.com.", Type: "MX", TTL: 60, Records: []string{"10 mail.example.com.", "20 mail2.example.com."}},
+		{Name: "www.example.com.", Type: "A", Records: []string{"10.1.1.1"}},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, "example.com.", 1800, recordSets); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(&buf, "ignored.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordSets[2].TTL = 1800
+	if !reflect.DeepEqual(parsed, recordSets) {
+		t.Errorf("got %+v, expected %+v", parsed, recordSets)
+	}
+}